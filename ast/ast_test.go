@@ -2,6 +2,7 @@ package ast
 
 import (
 	"monkey/token"
+	"strconv"
 	"testing"
 )
 
@@ -26,3 +27,42 @@ func TestString(t *testing.T) {
 		t.Errorf("program.String() returned wrong value: %q", program.String())
 	}
 }
+
+func TestModify(t *testing.T) {
+	intLit := func(value int64) Expr {
+		return &IntLiteralExpr{Token: &token.Token{Type: token.Int, Literal: strconv.FormatInt(value, 10)}, Value: value}
+	}
+	one := func() Expr { return intLit(1) }
+	two := func() Expr { return intLit(2) }
+	turnOneIntoTwo := func(node Node) Node {
+		if i, ok := node.(*IntLiteralExpr); ok && i.Value == 1 {
+			return two()
+		}
+		return node
+	}
+
+	letTok := &token.Token{Type: token.Let, Literal: "let"}
+	tests := []struct {
+		input, expected Node
+	}{
+		{one(), two()},
+		{&Program{Stmts: []Stmt{&ExprStmt{Expr: one()}}}, &Program{Stmts: []Stmt{&ExprStmt{Expr: two()}}}},
+		{&InfixExpr{Left: one(), Operator: "+", Right: two()}, &InfixExpr{Left: two(), Operator: "+", Right: two()}},
+		{&PrefixExpr{Operator: "-", Right: one()}, &PrefixExpr{Operator: "-", Right: two()}},
+		{&IndexExpr{Left: one(), Index: one()}, &IndexExpr{Left: two(), Index: two()}},
+		{&SliceExpr{Left: one(), Start: one(), Step: one()}, &SliceExpr{Left: two(), Start: two(), Step: two()}},
+		{&ArrayExpr{Elems: []Expr{one(), one()}}, &ArrayExpr{Elems: []Expr{two(), two()}}},
+		{&HashExpr{Pairs: []*HashPair{{Key: one(), Value: one()}}}, &HashExpr{Pairs: []*HashPair{{Key: two(), Value: two()}}}},
+		{&LetStmt{Token: letTok, Name: &IdentExpr{Value: "x"}, Value: one()}, &LetStmt{Token: letTok, Name: &IdentExpr{Value: "x"}, Value: two()}},
+	}
+
+	for _, tt := range tests {
+		before := tt.input.String()
+		if output := Modify(tt.input, turnOneIntoTwo).String(); output != tt.expected.String() {
+			t.Errorf("Expected %q, got %q", tt.expected.String(), output)
+		}
+		if tt.input.String() != before {
+			t.Errorf("Modify changed its input %q to %q", before, tt.input.String())
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"monkey/token"
+	"regexp"
 	"strings"
 )
 
@@ -17,7 +18,8 @@ type IdentExpr struct {
 	Value string
 }
 
-func (i *IdentExpr) exprNode() {}
+func (i *IdentExpr) exprNode()    {}
+func (i *IdentExpr) patternNode() {}
 func (i *IdentExpr) String() string {
 	return i.Value
 }
@@ -27,7 +29,8 @@ type IntLiteralExpr struct {
 	Value int64
 }
 
-func (i *IntLiteralExpr) exprNode() {}
+func (i *IntLiteralExpr) exprNode()    {}
+func (i *IntLiteralExpr) patternNode() {}
 func (i *IntLiteralExpr) String() string {
 	return i.Token.Literal
 }
@@ -37,7 +40,8 @@ type StringExpr struct {
 	Value string
 }
 
-func (s *StringExpr) exprNode() {}
+func (s *StringExpr) exprNode()    {}
+func (s *StringExpr) patternNode() {}
 func (s *StringExpr) String() string {
 	return fmt.Sprintf("\"%s\"", s.Value)
 }
@@ -47,11 +51,29 @@ type BoolExpr struct {
 	Value bool
 }
 
-func (b *BoolExpr) exprNode() {}
+func (b *BoolExpr) exprNode()    {}
+func (b *BoolExpr) patternNode() {}
 func (b *BoolExpr) String() string {
 	return b.Token.Literal
 }
 
+// RegexExpr is a regex literal, compiled when parsed.
+type RegexExpr struct {
+	Token  *token.Token
+	Regexp *regexp.Regexp
+}
+
+func (re *RegexExpr) exprNode()      {}
+func (re *RegexExpr) String() string { return `re"` + re.Regexp.String() + `"` }
+
+type NullExpr struct {
+	Token *token.Token
+}
+
+func (n *NullExpr) exprNode()      {}
+func (n *NullExpr) patternNode()   {}
+func (n *NullExpr) String() string { return "null" }
+
 type PrefixExpr struct {
 	Token    *token.Token
 	Operator string
@@ -79,6 +101,23 @@ func (ide *IncDecExpr) String() string {
 	return ide.Operator + ide.Ident.String()
 }
 
+type AssignExpr struct {
+	Token *token.Token
+	Name  *IdentExpr
+	Value Expr
+}
+
+func (ae *AssignExpr) exprNode() {}
+func (ae *AssignExpr) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(ae.Name.String())
+	out.WriteString(" = ")
+	out.WriteString(ae.Value.String())
+	out.WriteString(")")
+	return out.String()
+}
+
 type InfixExpr struct {
 	Token    *token.Token
 	Operator string
@@ -98,8 +137,10 @@ func (ie *InfixExpr) String() string {
 }
 
 type FuncExpr struct {
-	Token *token.Token
-	Args  []*IdentExpr
+	Token     *token.Token
+	Args      []Pattern
+	Return    Type // nil if not annotated.
+	Generator bool // Set if the body yields.
 	*BlockStmt
 }
 
@@ -113,10 +154,28 @@ func (fe *FuncExpr) String() string {
 	out.WriteString("fn(")
 	out.WriteString(strings.Join(args, ", "))
 	out.WriteString(") ")
+	if fe.Return != nil {
+		out.WriteString("-> " + fe.Return.String() + " ")
+	}
 	out.WriteString(fe.BlockStmt.String())
 	return out.String()
 }
 
+type MacroExpr struct {
+	Token *token.Token
+	Args  []*IdentExpr
+	Body  *BlockStmt
+}
+
+func (me *MacroExpr) exprNode() {}
+func (me *MacroExpr) String() string {
+	args := make([]string, len(me.Args))
+	for i, arg := range me.Args {
+		args[i] = arg.String()
+	}
+	return "macro(" + strings.Join(args, ", ") + ") " + me.Body.String()
+}
+
 type IfExpr struct {
 	Token *token.Token
 	Cond  Expr
@@ -138,22 +197,291 @@ func (ie *IfExpr) String() string {
 	return out.String()
 }
 
-type FuncCallExpr struct {
+type TryExpr struct {
+	Token   *token.Token
+	Body    *BlockStmt
+	Param   Pattern
+	Catch   *BlockStmt
+	Finally *BlockStmt
+}
+
+func (te *TryExpr) exprNode() {}
+func (te *TryExpr) String() string {
+	var out bytes.Buffer
+	out.WriteString("try ")
+	out.WriteString(te.Body.String())
+	if te.Catch != nil {
+		out.WriteString(" catch ")
+		if te.Param != nil {
+			out.WriteString("(" + te.Param.String() + ") ")
+		}
+		out.WriteString(te.Catch.String())
+	}
+	if te.Finally != nil {
+		out.WriteString(" finally ")
+		out.WriteString(te.Finally.String())
+	}
+	return out.String()
+}
+
+type SpawnExpr struct {
+	Token *token.Token
+	Call  *FuncCallExpr
+}
+
+func (se *SpawnExpr) exprNode() {}
+func (se *SpawnExpr) String() string {
+	return se.Token.Literal + " " + se.Call.String()
+}
+
+type SelectExpr struct {
 	Token *token.Token
-	Func  Expr
-	Args  []Expr
+	Cases []*SelectCase
+}
+
+// SelectCase is a `ch.send(x)` or `ch.recv() as pattern` case, or the default
+// case if Op is nil.
+type SelectCase struct {
+	Op      *FuncCallExpr
+	Binding Pattern
+	Body    Stmt
+}
+
+func (se *SelectExpr) exprNode() {}
+func (se *SelectExpr) String() string {
+	cases := make([]string, len(se.Cases))
+	for i, c := range se.Cases {
+		cases[i] = c.String()
+	}
+	return se.Token.Literal + " {" + strings.Join(cases, ", ") + "}"
+}
+
+func (sc *SelectCase) String() string {
+	op := "_"
+	if sc.Op != nil {
+		op = sc.Op.String()
+	}
+	if sc.Binding != nil {
+		op += " as " + sc.Binding.String()
+	}
+	return op + " => " + sc.Body.String()
+}
+
+type MatchExpr struct {
+	Token   *token.Token
+	Subject Expr
+	Arms    []*MatchArm
+}
+
+type MatchArm struct {
+	Pattern Pattern
+	Guard   Expr
+	Body    Stmt
+}
+
+func (ma *MatchArm) String() string {
+	var out bytes.Buffer
+	out.WriteString(ma.Pattern.String())
+	if ma.Guard != nil {
+		out.WriteString(" if ")
+		out.WriteString(ma.Guard.String())
+	}
+	out.WriteString(" => ")
+	out.WriteString(ma.Body.String())
+	return out.String()
+}
+
+func (me *MatchExpr) exprNode() {}
+func (me *MatchExpr) String() string {
+	var out bytes.Buffer
+	arms := make([]string, len(me.Arms))
+	for i, arm := range me.Arms {
+		arms[i] = arm.String()
+	}
+	out.WriteString("match ")
+	out.WriteString(me.Subject.String())
+	out.WriteString(" {")
+	out.WriteString(strings.Join(arms, ", "))
+	out.WriteString("}")
+	return out.String()
+}
+
+type FuncCallExpr struct {
+	Token    *token.Token
+	Func     Expr
+	Args     []Expr
+	KwArgs   []*KeywordArg
+	Optional bool // Set for `f?.()`.
+}
+
+type KeywordArg struct {
+	Name  *IdentExpr
+	Value Expr
+}
+
+func (ka *KeywordArg) String() string {
+	return ka.Name.String() + ": " + ka.Value.String()
 }
 
 func (fce *FuncCallExpr) exprNode() {}
 func (fce *FuncCallExpr) String() string {
 	var out bytes.Buffer
 	out.WriteString(fce.Func.String())
+	if fce.Optional {
+		out.WriteString("?.")
+	}
 	out.WriteString("(")
-	args := make([]string, 0, len(fce.Args))
+	args := make([]string, 0, len(fce.Args)+len(fce.KwArgs))
 	for _, arg := range fce.Args {
 		args = append(args, arg.String())
 	}
+	for _, kwarg := range fce.KwArgs {
+		args = append(args, kwarg.String())
+	}
 	out.WriteString(strings.Join(args, ", "))
 	out.WriteString(")")
 	return out.String()
 }
+
+type ArrayExpr struct {
+	Token *token.Token
+	Elems []Expr
+}
+
+func (ae *ArrayExpr) exprNode() {}
+func (ae *ArrayExpr) String() string {
+	elems := make([]string, len(ae.Elems))
+	for i, elem := range ae.Elems {
+		elems[i] = elem.String()
+	}
+	return "[" + strings.Join(elems, ", ") + "]"
+}
+
+type HashExpr struct {
+	Token *token.Token
+	Pairs []*HashPair
+}
+
+type HashPair struct {
+	Key, Value Expr
+}
+
+func (he *HashExpr) exprNode() {}
+func (he *HashExpr) String() string {
+	pairs := make([]string, len(he.Pairs))
+	for i, pair := range he.Pairs {
+		pairs[i] = pair.Key.String() + ": " + pair.Value.String()
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// ComprehensionExpr is `[value for x in xs if cond]`, or with a Key,
+// `{key: value for k, v in h}`.
+type ComprehensionExpr struct {
+	Token    *token.Token
+	Key      Expr // nil for an array
+	Value    Expr
+	Vars     []Pattern
+	Iterable Expr
+	Cond     Expr // nil without an `if`
+}
+
+func (ce *ComprehensionExpr) exprNode() {}
+func (ce *ComprehensionExpr) String() string {
+	vars := make([]string, len(ce.Vars))
+	for i, v := range ce.Vars {
+		vars[i] = v.String()
+	}
+	out := ce.Value.String() + " for " + strings.Join(vars, ", ") + " in " + ce.Iterable.String()
+	if ce.Cond != nil {
+		out += " if " + ce.Cond.String()
+	}
+	if ce.Key != nil {
+		return "{" + ce.Key.String() + ": " + out + "}"
+	}
+	return "[" + out + "]"
+}
+
+type MemberExpr struct {
+	Token    *token.Token
+	Object   Expr
+	Member   *IdentExpr
+	Optional bool // Set for `a?.b`.
+}
+
+func (me *MemberExpr) exprNode() {}
+func (me *MemberExpr) String() string {
+	if me.Optional {
+		return me.Object.String() + "?." + me.Member.String()
+	}
+	return me.Object.String() + "." + me.Member.String()
+}
+
+type StructLiteralExpr struct {
+	Token  *token.Token
+	Type   Expr
+	Fields []*KeywordArg
+}
+
+func (sle *StructLiteralExpr) exprNode() {}
+func (sle *StructLiteralExpr) String() string {
+	fields := make([]string, len(sle.Fields))
+	for i, field := range sle.Fields {
+		fields[i] = field.String()
+	}
+	return sle.Type.String() + "{" + strings.Join(fields, ", ") + "}"
+}
+
+type IndexExpr struct {
+	Token    *token.Token
+	Left     Expr
+	Index    Expr
+	Optional bool // Set for `a?.[i]`.
+}
+
+func (ie *IndexExpr) exprNode() {}
+func (ie *IndexExpr) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(ie.Left.String())
+	if ie.Optional {
+		out.WriteString("?.")
+	}
+	out.WriteString("[")
+	out.WriteString(ie.Index.String())
+	out.WriteString("])")
+	return out.String()
+}
+
+type SliceExpr struct {
+	Token            *token.Token
+	Left             Expr
+	Start, End, Step Expr // nil when omitted
+	Optional         bool // Set for `a?.[i:j]`.
+}
+
+func (se *SliceExpr) exprNode() {}
+func (se *SliceExpr) String() string {
+	bound := func(expr Expr) string {
+		if expr == nil {
+			return ""
+		}
+		return expr.String()
+	}
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(se.Left.String())
+	if se.Optional {
+		out.WriteString("?.")
+	}
+	out.WriteString("[")
+	out.WriteString(bound(se.Start))
+	out.WriteString(":")
+	out.WriteString(bound(se.End))
+	if se.Step != nil {
+		out.WriteString(":")
+		out.WriteString(se.Step.String())
+	}
+	out.WriteString("])")
+	return out.String()
+}
@@ -0,0 +1,326 @@
+package ast
+
+type ModifierFunc func(Node) Node
+
+// Modify returns a copy of node in which every node has been replaced by the
+// result of modifier, children first; node itself is left unchanged. A
+// replacement that does not fit its position is ignored. The names of fields,
+// members and keyword arguments are not visited.
+func Modify(node Node, modifier ModifierFunc) Node {
+	switch n := node.(type) {
+	case *Program:
+		c := *n
+		c.Stmts = make([]Stmt, len(n.Stmts))
+		for i, stmt := range n.Stmts {
+			c.Stmts[i] = modifyStmt(stmt, modifier)
+		}
+		node = &c
+	case *BlockStmt:
+		c := *n
+		c.Stmts = make([]*Stmt, len(n.Stmts))
+		for i, stmt := range n.Stmts {
+			s := modifyStmt(*stmt, modifier)
+			c.Stmts[i] = &s
+		}
+		node = &c
+	case *ExprStmt:
+		c := *n
+		c.Expr = modifyExpr(n.Expr, modifier)
+		node = &c
+	case *LetStmt:
+		c := *n
+		c.Name = modifyPattern(n.Name, modifier)
+		c.Value = modifyExpr(n.Value, modifier)
+		node = &c
+	case *FuncStmt:
+		c := *n
+		c.Name = modifyIdent(n.Name, modifier)
+		c.Func = modifyFunc(n.Func, modifier)
+		node = &c
+	case *ImportStmt:
+		c := *n
+		c.Alias = modifyIdent(n.Alias, modifier)
+		node = &c
+	case *ExportStmt:
+		c := *n
+		c.Stmt = modifyStmt(n.Stmt, modifier)
+		node = &c
+	case *StructStmt:
+		c := *n
+		c.Name = modifyIdent(n.Name, modifier)
+		c.Methods = modifyMethods(n.Methods, modifier)
+		node = &c
+	case *EnumStmt:
+		c := *n
+		c.Name = modifyIdent(n.Name, modifier)
+		c.Methods = modifyMethods(n.Methods, modifier)
+		node = &c
+	case *ReturnStmt:
+		c := *n
+		c.Value = modifyExpr(n.Value, modifier)
+		node = &c
+	case *ThrowStmt:
+		c := *n
+		c.Value = modifyExpr(n.Value, modifier)
+		node = &c
+	case *YieldStmt:
+		c := *n
+		c.Value = modifyExpr(n.Value, modifier)
+		node = &c
+	case *DeferStmt:
+		c := *n
+		c.Call = modifyCall(n.Call, modifier)
+		node = &c
+	case *ForStmt:
+		c := *n
+		c.Var = modifyPattern(n.Var, modifier)
+		c.Iterable = modifyExpr(n.Iterable, modifier)
+		c.Body = modifyBlock(n.Body, modifier)
+		node = &c
+
+	case *PrefixExpr:
+		c := *n
+		c.Right = modifyExpr(n.Right, modifier)
+		node = &c
+	case *IncDecExpr:
+		c := *n
+		c.Ident = *modifyIdent(&n.Ident, modifier)
+		node = &c
+	case *AssignExpr:
+		c := *n
+		c.Name = modifyIdent(n.Name, modifier)
+		c.Value = modifyExpr(n.Value, modifier)
+		node = &c
+	case *InfixExpr:
+		c := *n
+		c.Left = modifyExpr(n.Left, modifier)
+		c.Right = modifyExpr(n.Right, modifier)
+		node = &c
+	case *FuncExpr:
+		c := *n
+		c.Args = modifyPatterns(n.Args, modifier)
+		c.BlockStmt = modifyBlock(n.BlockStmt, modifier)
+		node = &c
+	case *MacroExpr:
+		c := *n
+		c.Args = make([]*IdentExpr, len(n.Args))
+		for i, arg := range n.Args {
+			c.Args[i] = modifyIdent(arg, modifier)
+		}
+		c.Body = modifyBlock(n.Body, modifier)
+		node = &c
+	case *IfExpr:
+		c := *n
+		c.Cond = modifyExpr(n.Cond, modifier)
+		c.Then = modifyStmt(n.Then, modifier)
+		c.Else = modifyStmt(n.Else, modifier)
+		node = &c
+	case *TryExpr:
+		c := *n
+		c.Body = modifyBlock(n.Body, modifier)
+		c.Param = modifyPattern(n.Param, modifier)
+		c.Catch = modifyBlock(n.Catch, modifier)
+		c.Finally = modifyBlock(n.Finally, modifier)
+		node = &c
+	case *SpawnExpr:
+		c := *n
+		c.Call = modifyCall(n.Call, modifier)
+		node = &c
+	case *SelectExpr:
+		c := *n
+		c.Cases = make([]*SelectCase, len(n.Cases))
+		for i, sc := range n.Cases {
+			c.Cases[i] = &SelectCase{
+				Op:      modifyCall(sc.Op, modifier),
+				Binding: modifyPattern(sc.Binding, modifier),
+				Body:    modifyStmt(sc.Body, modifier),
+			}
+		}
+		node = &c
+	case *MatchExpr:
+		c := *n
+		c.Subject = modifyExpr(n.Subject, modifier)
+		c.Arms = make([]*MatchArm, len(n.Arms))
+		for i, arm := range n.Arms {
+			c.Arms[i] = &MatchArm{
+				Pattern: modifyPattern(arm.Pattern, modifier),
+				Guard:   modifyExpr(arm.Guard, modifier),
+				Body:    modifyStmt(arm.Body, modifier),
+			}
+		}
+		node = &c
+	case *FuncCallExpr:
+		c := *n
+		c.Func = modifyExpr(n.Func, modifier)
+		c.Args = modifyExprs(n.Args, modifier)
+		c.KwArgs = modifyKwArgs(n.KwArgs, modifier)
+		node = &c
+	case *ArrayExpr:
+		c := *n
+		c.Elems = modifyExprs(n.Elems, modifier)
+		node = &c
+	case *ComprehensionExpr:
+		c := *n
+		c.Key = modifyExpr(n.Key, modifier)
+		c.Value = modifyExpr(n.Value, modifier)
+		c.Vars = modifyPatterns(n.Vars, modifier)
+		c.Iterable = modifyExpr(n.Iterable, modifier)
+		c.Cond = modifyExpr(n.Cond, modifier)
+		node = &c
+	case *HashExpr:
+		c := *n
+		c.Pairs = make([]*HashPair, len(n.Pairs))
+		for i, pair := range n.Pairs {
+			c.Pairs[i] = &HashPair{Key: modifyExpr(pair.Key, modifier), Value: modifyExpr(pair.Value, modifier)}
+		}
+		node = &c
+	case *MemberExpr:
+		c := *n
+		c.Object = modifyExpr(n.Object, modifier)
+		node = &c
+	case *StructLiteralExpr:
+		c := *n
+		c.Type = modifyExpr(n.Type, modifier)
+		c.Fields = modifyKwArgs(n.Fields, modifier)
+		node = &c
+	case *IndexExpr:
+		c := *n
+		c.Left = modifyExpr(n.Left, modifier)
+		c.Index = modifyExpr(n.Index, modifier)
+		node = &c
+	case *SliceExpr:
+		c := *n
+		c.Left = modifyExpr(n.Left, modifier)
+		c.Start = modifyExpr(n.Start, modifier)
+		c.End = modifyExpr(n.End, modifier)
+		c.Step = modifyExpr(n.Step, modifier)
+		node = &c
+
+	case *ArrayPattern:
+		c := *n
+		c.Elems = modifyPatterns(n.Elems, modifier)
+		c.Rest = modifyIdent(n.Rest, modifier)
+		node = &c
+	case *HashPattern:
+		c := *n
+		c.Entries = make([]*HashPatternEntry, len(n.Entries))
+		for i, entry := range n.Entries {
+			c.Entries[i] = &HashPatternEntry{Key: entry.Key, Value: modifyPattern(entry.Value, modifier)}
+		}
+		node = &c
+	case *TypedPattern:
+		c := *n
+		c.Pattern = modifyPattern(n.Pattern, modifier)
+		node = &c
+	case *ConstructorPattern:
+		c := *n
+		c.Type = modifyExpr(n.Type, modifier)
+		if n.Args != nil {
+			c.Args = modifyPatterns(n.Args, modifier)
+		}
+		node = &c
+	}
+	return modifier(node)
+}
+
+func modifyStmt(stmt Stmt, modifier ModifierFunc) Stmt {
+	if stmt == nil {
+		return nil
+	}
+	if stmt, ok := Modify(stmt, modifier).(Stmt); ok {
+		return stmt
+	}
+	return stmt
+}
+
+func modifyExpr(expr Expr, modifier ModifierFunc) Expr {
+	if expr == nil {
+		return nil
+	}
+	if expr, ok := Modify(expr, modifier).(Expr); ok {
+		return expr
+	}
+	return expr
+}
+
+func modifyPattern(pattern Pattern, modifier ModifierFunc) Pattern {
+	if pattern == nil {
+		return nil
+	}
+	if pattern, ok := Modify(pattern, modifier).(Pattern); ok {
+		return pattern
+	}
+	return pattern
+}
+
+func modifyIdent(ident *IdentExpr, modifier ModifierFunc) *IdentExpr {
+	if ident == nil {
+		return nil
+	}
+	if ident, ok := Modify(ident, modifier).(*IdentExpr); ok {
+		return ident
+	}
+	return ident
+}
+
+func modifyBlock(block *BlockStmt, modifier ModifierFunc) *BlockStmt {
+	if block == nil {
+		return nil
+	}
+	if block, ok := Modify(block, modifier).(*BlockStmt); ok {
+		return block
+	}
+	return block
+}
+
+func modifyFunc(fn *FuncExpr, modifier ModifierFunc) *FuncExpr {
+	if fn, ok := Modify(fn, modifier).(*FuncExpr); ok {
+		return fn
+	}
+	return fn
+}
+
+func modifyCall(call *FuncCallExpr, modifier ModifierFunc) *FuncCallExpr {
+	if call == nil {
+		return nil
+	}
+	if call, ok := Modify(call, modifier).(*FuncCallExpr); ok {
+		return call
+	}
+	return call
+}
+
+func modifyMethods(methods []*FuncStmt, modifier ModifierFunc) []*FuncStmt {
+	c := make([]*FuncStmt, len(methods))
+	for i, method := range methods {
+		c[i] = method
+		if method, ok := Modify(method, modifier).(*FuncStmt); ok {
+			c[i] = method
+		}
+	}
+	return c
+}
+
+func modifyExprs(exprs []Expr, modifier ModifierFunc) []Expr {
+	c := make([]Expr, len(exprs))
+	for i, expr := range exprs {
+		c[i] = modifyExpr(expr, modifier)
+	}
+	return c
+}
+
+func modifyPatterns(patterns []Pattern, modifier ModifierFunc) []Pattern {
+	c := make([]Pattern, len(patterns))
+	for i, pattern := range patterns {
+		c[i] = modifyPattern(pattern, modifier)
+	}
+	return c
+}
+
+func modifyKwArgs(kwargs []*KeywordArg, modifier ModifierFunc) []*KeywordArg {
+	c := make([]*KeywordArg, len(kwargs))
+	for i, kwarg := range kwargs {
+		c[i] = &KeywordArg{Name: kwarg.Name, Value: modifyExpr(kwarg.Value, modifier)}
+	}
+	return c
+}
@@ -0,0 +1,118 @@
+package ast
+
+import (
+	"monkey/token"
+	"strings"
+)
+
+type Pattern interface {
+	Node
+	patternNode()
+}
+
+type ArrayPattern struct {
+	Token *token.Token
+	Elems []Pattern
+	Rest  *IdentExpr
+}
+
+func (ap *ArrayPattern) patternNode() {}
+func (ap *ArrayPattern) String() string {
+	elems := make([]string, 0, len(ap.Elems)+1)
+	for _, elem := range ap.Elems {
+		elems = append(elems, elem.String())
+	}
+	if ap.Rest != nil {
+		elems = append(elems, "..."+ap.Rest.String())
+	}
+	return "[" + strings.Join(elems, ", ") + "]"
+}
+
+type HashPattern struct {
+	Token   *token.Token
+	Entries []*HashPatternEntry
+}
+
+type HashPatternEntry struct {
+	Key   string
+	Value Pattern
+}
+
+func (hp *HashPattern) patternNode() {}
+func (hp *HashPattern) String() string {
+	entries := make([]string, len(hp.Entries))
+	for i, entry := range hp.Entries {
+		if ident, ok := entry.Value.(*IdentExpr); ok && ident.Value == entry.Key {
+			entries[i] = entry.Key
+		} else {
+			entries[i] = entry.Key + ": " + entry.Value.String()
+		}
+	}
+	return "{" + strings.Join(entries, ", ") + "}"
+}
+
+// ConstructorPattern matches a struct or enum variant, like `Shape.Circle(r)`.
+// Without parentheses it only checks the variant.
+type ConstructorPattern struct {
+	Token *token.Token
+	Type  Expr
+	Args  []Pattern
+}
+
+func (cp *ConstructorPattern) patternNode() {}
+func (cp *ConstructorPattern) String() string {
+	if cp.Args == nil {
+		return cp.Type.String()
+	}
+	args := make([]string, len(cp.Args))
+	for i, arg := range cp.Args {
+		args[i] = arg.String()
+	}
+	return cp.Type.String() + "(" + strings.Join(args, ", ") + ")"
+}
+
+// TypedPattern is an annotated let name or function parameter, like `x: int`.
+type TypedPattern struct {
+	Token   *token.Token
+	Pattern Pattern
+	Type    Type
+}
+
+func (tp *TypedPattern) patternNode() {}
+func (tp *TypedPattern) String() string {
+	return tp.Pattern.String() + ": " + tp.Type.String()
+}
+
+// PatternNames returns the names bound by pattern.
+func PatternNames(pattern Pattern) []string {
+	switch pattern := pattern.(type) {
+	case *IdentExpr:
+		if pattern.Value != "_" {
+			return []string{pattern.Value}
+		}
+	case *TypedPattern:
+		return PatternNames(pattern.Pattern)
+	case *ArrayPattern:
+		var names []string
+		for _, elem := range pattern.Elems {
+			names = append(names, PatternNames(elem)...)
+		}
+		if pattern.Rest != nil {
+			names = append(names, pattern.Rest.Value)
+		}
+		return names
+	case *HashPattern:
+		var names []string
+		for _, entry := range pattern.Entries {
+			names = append(names, PatternNames(entry.Value)...)
+		}
+		return names
+	case *ConstructorPattern:
+		var names []string
+		for _, arg := range pattern.Args {
+			names = append(names, PatternNames(arg)...)
+		}
+		return names
+	}
+	return nil
+}
@@ -13,8 +13,9 @@ type Stmt interface {
 
 type LetStmt struct {
 	Token *token.Token
-	Name  *IdentExpr
+	Name  Pattern
 	Value Expr
+	Doc   string
 }
 
 func (ls *LetStmt) stmtNode() {}
@@ -30,6 +31,93 @@ func (ls *LetStmt) String() string {
 	return out.String()
 }
 
+type FuncStmt struct {
+	Token *token.Token
+	Name  *IdentExpr
+	Func  *FuncExpr
+	Doc   string
+}
+
+func (fs *FuncStmt) stmtNode() {}
+func (fs *FuncStmt) String() string {
+	return "fn " + fs.Name.String() + strings.TrimPrefix(fs.Func.String(), "fn")
+}
+
+type ImportStmt struct {
+	Token *token.Token
+	Path  *StringExpr
+	Alias *IdentExpr
+}
+
+func (is *ImportStmt) stmtNode() {}
+func (is *ImportStmt) String() string {
+	return is.Token.Literal + " " + is.Path.String() + " as " + is.Alias.String() + ";"
+}
+
+type ExportStmt struct {
+	Token *token.Token
+	Stmt  Stmt
+}
+
+func (es *ExportStmt) stmtNode() {}
+func (es *ExportStmt) String() string {
+	return es.Token.Literal + " " + es.Stmt.String()
+}
+
+type StructStmt struct {
+	Token   *token.Token
+	Name    *IdentExpr
+	Fields  []*IdentExpr
+	Methods []*FuncStmt
+}
+
+func (ss *StructStmt) stmtNode() {}
+func (ss *StructStmt) String() string {
+	members := make([]string, 0, len(ss.Fields)+len(ss.Methods))
+	for _, field := range ss.Fields {
+		members = append(members, field.String())
+	}
+	for _, method := range ss.Methods {
+		members = append(members, method.String())
+	}
+	return ss.Token.Literal + " " + ss.Name.String() + " {" + strings.Join(members, ", ") + "}"
+}
+
+type EnumStmt struct {
+	Token    *token.Token
+	Name     *IdentExpr
+	Variants []*EnumVariant
+	Methods  []*FuncStmt
+}
+
+type EnumVariant struct {
+	Name   *IdentExpr
+	Fields []*IdentExpr // nil for a variant without parentheses.
+}
+
+func (es *EnumStmt) stmtNode() {}
+func (es *EnumStmt) String() string {
+	members := make([]string, 0, len(es.Variants)+len(es.Methods))
+	for _, variant := range es.Variants {
+		members = append(members, variant.String())
+	}
+	for _, method := range es.Methods {
+		members = append(members, method.String())
+	}
+	return es.Token.Literal + " " + es.Name.String() + " {" + strings.Join(members, ", ") + "}"
+}
+
+func (ev *EnumVariant) String() string {
+	if ev.Fields == nil {
+		return ev.Name.String()
+	}
+	fields := make([]string, len(ev.Fields))
+	for i, field := range ev.Fields {
+		fields[i] = field.String()
+	}
+	return ev.Name.String() + "(" + strings.Join(fields, ", ") + ")"
+}
+
 type ReturnStmt struct {
 	Token *token.Token
 	Value Expr
@@ -46,17 +134,76 @@ func (rs *ReturnStmt) String() string {
 	return out.String()
 }
 
-type ExprStmt struct {
+type ThrowStmt struct {
+	Token *token.Token
+	Value Expr
+}
+
+func (ts *ThrowStmt) stmtNode() {}
+func (ts *ThrowStmt) String() string {
+	return ts.Token.Literal + " " + ts.Value.String() + ";"
+}
+
+type DeferStmt struct {
+	Token *token.Token
+	Call  *FuncCallExpr
+}
+
+func (ds *DeferStmt) stmtNode() {}
+func (ds *DeferStmt) String() string {
+	return ds.Token.Literal + " " + ds.Call.String() + ";"
+}
+
+type YieldStmt struct {
+	Token *token.Token
+	Value Expr
+}
+
+func (ys *YieldStmt) stmtNode() {}
+func (ys *YieldStmt) String() string {
+	if ys.Value == nil {
+		return ys.Token.Literal + ";"
+	}
+	return ys.Token.Literal + " " + ys.Value.String() + ";"
+}
+
+type ForStmt struct {
+	Token    *token.Token
+	Var      Pattern
+	Iterable Expr
+	Body     *BlockStmt
+}
+
+func (fs *ForStmt) stmtNode() {}
+func (fs *ForStmt) String() string {
+	return fs.Token.Literal + " (" + fs.Var.String() + " in " + fs.Iterable.String() + ") " + fs.Body.String()
+}
+
+// BranchStmt is a break or continue.
+type BranchStmt struct {
 	Token *token.Token
-	Expr  Expr
+}
+
+func (bs *BranchStmt) stmtNode() {}
+func (bs *BranchStmt) String() string {
+	return bs.Token.Literal + ";"
+}
+
+type ExprStmt struct {
+	Token   *token.Token
+	Expr    Expr
+	Discard bool
 }
 
 func (es *ExprStmt) stmtNode() {}
 func (es *ExprStmt) String() string {
-	if es.Expr != nil {
-		return es.Expr.String()
+	if es.Expr == nil {
+		return ""
+	}
+	if es.Discard {
+		return es.Expr.String() + ";"
 	}
-	return ""
+	return es.Expr.String()
 }
 
 type BlockStmt struct {
@@ -0,0 +1,55 @@
+package ast
+
+import (
+	"monkey/token"
+	"strings"
+)
+
+// Type is a type annotation. Annotations are only read by the checker.
+type Type interface {
+	Node
+	typeNode()
+}
+
+type NamedType struct {
+	Token *token.Token
+	Name  string
+}
+
+func (nt *NamedType) typeNode()      {}
+func (nt *NamedType) String() string { return nt.Name }
+
+type ArrayType struct {
+	Token *token.Token
+	Elem  Type
+}
+
+func (at *ArrayType) typeNode()      {}
+func (at *ArrayType) String() string { return "[" + at.Elem.String() + "]" }
+
+type HashType struct {
+	Token      *token.Token
+	Key, Value Type
+}
+
+func (ht *HashType) typeNode()      {}
+func (ht *HashType) String() string { return "{" + ht.Key.String() + ": " + ht.Value.String() + "}" }
+
+type FuncType struct {
+	Token  *token.Token
+	Args   []Type
+	Return Type // nil if not given.
+}
+
+func (ft *FuncType) typeNode() {}
+func (ft *FuncType) String() string {
+	args := make([]string, len(ft.Args))
+	for i, arg := range ft.Args {
+		args[i] = arg.String()
+	}
+	out := "fn(" + strings.Join(args, ", ") + ")"
+	if ft.Return != nil {
+		out += " -> " + ft.Return.String()
+	}
+	return out
+}
@@ -0,0 +1,617 @@
+package checker
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/token"
+	"sort"
+)
+
+type Error struct {
+	Pos *token.Token
+	Msg string
+}
+
+func (e *Error) String() string {
+	if e.Pos == nil {
+		return e.Msg
+	}
+	return fmt.Sprintf("Row %d, col %d: %s", e.Pos.Row, e.Pos.Col, e.Msg)
+}
+
+type binding struct {
+	typ       Type
+	annotated bool
+}
+
+type scope struct {
+	vars  map[string]*binding
+	outer *scope
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{vars: make(map[string]*binding), outer: outer}
+}
+
+func (s *scope) lookup(name string) (*binding, bool) {
+	for ; s != nil; s = s.outer {
+		if b, ok := s.vars[name]; ok {
+			return b, true
+		}
+	}
+	return nil, false
+}
+
+type checker struct {
+	errors []Error
+	named  map[string]bool
+	// Function bodies are checked at the end of the enclosing block, since
+	// they can refer to names declared after them.
+	pending [][]func()
+	// Declared return types of the functions being checked; nil if absent.
+	returns []Type
+}
+
+// Check reports the type errors it can find in prog without running it.
+// Unannotated code is checked only for unknown identifiers and arity, and for
+// whatever its literals imply.
+func Check(prog *ast.Program) []Error {
+	c := &checker{named: make(map[string]bool)}
+	c.stmts(prog.Stmts, newScope(nil))
+	sort.SliceStable(c.errors, func(i, j int) bool {
+		a, b := c.errors[i].Pos, c.errors[j].Pos
+		return a != nil && b != nil && (a.Row < b.Row || a.Row == b.Row && a.Col < b.Col)
+	})
+	return c.errors
+}
+
+func (c *checker) errorf(tok *token.Token, format string, a ...interface{}) {
+	c.errors = append(c.errors, Error{Pos: tok, Msg: fmt.Sprintf(format, a...)})
+}
+
+func (c *checker) later(check func()) {
+	c.pending[len(c.pending)-1] = append(c.pending[len(c.pending)-1], check)
+}
+
+func (c *checker) stmts(stmts []ast.Stmt, s *scope) Type {
+	c.pending = append(c.pending, nil)
+	for _, stmt := range stmts {
+		c.hoist(stmt, s)
+	}
+	var typ Type = nullType
+	for _, stmt := range stmts {
+		typ = c.stmt(stmt, s)
+	}
+	pending := c.pending[len(c.pending)-1]
+	c.pending = c.pending[:len(c.pending)-1]
+	for _, check := range pending {
+		check()
+	}
+	return typ
+}
+
+func (c *checker) block(block *ast.BlockStmt, s *scope) Type {
+	if block == nil {
+		return nullType
+	}
+	stmts := make([]ast.Stmt, len(block.Stmts))
+	for i, stmt := range block.Stmts {
+		stmts[i] = *stmt
+	}
+	return c.stmts(stmts, newScope(s))
+}
+
+func (c *checker) hoist(stmt ast.Stmt, s *scope) {
+	if export, ok := stmt.(*ast.ExportStmt); ok {
+		stmt = export.Stmt
+	}
+	switch stmt := stmt.(type) {
+	case *ast.FuncStmt:
+		s.vars[stmt.Name.Value] = &binding{typ: c.function(stmt.Func, s, stmt.Name.Value), annotated: true}
+	case *ast.StructStmt:
+		c.named[stmt.Name.Value] = true
+		fields := make([]string, len(stmt.Fields))
+		for i, field := range stmt.Fields {
+			fields[i] = field.Value
+		}
+		s.vars[stmt.Name.Value] = &binding{typ: &structType{name: stmt.Name.Value, fields: fields}, annotated: true}
+		c.methods(stmt.Methods, s)
+	case *ast.EnumStmt:
+		c.named[stmt.Name.Value] = true
+		s.vars[stmt.Name.Value] = &binding{typ: anyType, annotated: true}
+		c.methods(stmt.Methods, s)
+	}
+}
+
+func (c *checker) methods(methods []*ast.FuncStmt, s *scope) {
+	for _, method := range methods {
+		c.function(method.Func, s, method.Name.Value)
+	}
+}
+
+func (c *checker) stmt(stmt ast.Stmt, s *scope) Type {
+	switch stmt := stmt.(type) {
+	case *ast.LetStmt:
+		typ := c.expr(stmt.Value, s)
+		c.bind(stmt.Name, typ, s, stmt.Token)
+		return nullType
+	case *ast.ImportStmt:
+		s.vars[stmt.Alias.Value] = &binding{typ: anyType}
+		return nullType
+	case *ast.ExportStmt:
+		return c.stmt(stmt.Stmt, s)
+	case *ast.FuncStmt, *ast.StructStmt, *ast.EnumStmt:
+		return nullType
+	case *ast.ReturnStmt:
+		typ := Type(nullType)
+		if stmt.Value != nil {
+			typ = c.expr(stmt.Value, s)
+		}
+		c.checkReturn(typ, stmt.Token)
+		return anyType
+	case *ast.ThrowStmt:
+		c.expr(stmt.Value, s)
+		return anyType
+	case *ast.YieldStmt:
+		if stmt.Value != nil {
+			c.expr(stmt.Value, s)
+		}
+		return nullType
+	case *ast.DeferStmt:
+		c.expr(stmt.Call, s)
+		return nullType
+	case *ast.ForStmt:
+		loop := newScope(s)
+		c.bind(stmt.Var, c.elem(c.expr(stmt.Iterable, s), stmt.Token), loop, stmt.Token)
+		c.block(stmt.Body, loop)
+		return nullType
+	case *ast.BranchStmt:
+		return anyType
+	case *ast.ExprStmt:
+		typ := c.expr(stmt.Expr, s)
+		if stmt.Discard {
+			return nullType
+		}
+		return typ
+	case *ast.BlockStmt:
+		return c.block(stmt, s)
+	}
+	return anyType
+}
+
+// bind declares the names of pattern, matched against a value of type typ.
+func (c *checker) bind(pattern ast.Pattern, typ Type, s *scope, tok *token.Token) {
+	if typed, ok := pattern.(*ast.TypedPattern); ok {
+		declared := c.resolve(typed.Type)
+		if !assignable(typ, declared) {
+			c.errorf(tok, "cannot use %s as %s in %s %s", typ, declared, tok.Literal, typed.Pattern)
+		}
+		c.declare(typed.Pattern, declared, true, s)
+		return
+	}
+	c.declare(pattern, typ, false, s)
+}
+
+func (c *checker) declare(pattern ast.Pattern, typ Type, annotated bool, s *scope) {
+	if ident, ok := pattern.(*ast.IdentExpr); ok {
+		if ident.Value != "_" {
+			s.vars[ident.Value] = &binding{typ: typ, annotated: annotated}
+		}
+		return
+	}
+	for _, name := range ast.PatternNames(pattern) {
+		s.vars[name] = &binding{typ: anyType}
+	}
+}
+
+func (c *checker) checkReturn(typ Type, tok *token.Token) {
+	if len(c.returns) == 0 {
+		return
+	}
+	if declared := c.returns[len(c.returns)-1]; declared != nil && !assignable(typ, declared) {
+		c.errorf(tok, "cannot return %s from a function returning %s", typ, declared)
+	}
+}
+
+func (c *checker) function(fn *ast.FuncExpr, s *scope, name string) *funcType {
+	typ := &funcType{ret: anyType}
+	params := make([]Type, len(fn.Args))
+	for i, arg := range fn.Args {
+		params[i] = anyType
+		if typed, ok := arg.(*ast.TypedPattern); ok {
+			params[i] = c.resolve(typed.Type)
+			arg = typed.Pattern
+		}
+		paramName := ""
+		if ident, ok := arg.(*ast.IdentExpr); ok {
+			paramName = ident.Value
+		}
+		typ.names = append(typ.names, paramName)
+	}
+	typ.params = params
+	var declared Type
+	if fn.Return != nil && !fn.Generator {
+		declared = c.resolve(fn.Return)
+		typ.ret = declared
+	}
+	c.later(func() {
+		body := newScope(s)
+		for i, arg := range fn.Args {
+			if typed, ok := arg.(*ast.TypedPattern); ok {
+				c.declare(typed.Pattern, params[i], true, body)
+			} else {
+				c.declare(arg, params[i], false, body)
+			}
+		}
+		c.returns = append(c.returns, declared)
+		ret := c.block(fn.BlockStmt, body)
+		if declared != nil && len(fn.BlockStmt.Stmts) > 0 {
+			if _, ok := (*fn.BlockStmt.Stmts[len(fn.BlockStmt.Stmts)-1]).(*ast.ReturnStmt); !ok {
+				c.checkReturn(ret, fn.BlockStmt.Token)
+			}
+		}
+		c.returns = c.returns[:len(c.returns)-1]
+	})
+	return typ
+}
+
+func (c *checker) resolve(typ ast.Type) Type {
+	switch typ := typ.(type) {
+	case *ast.NamedType:
+		if basic, ok := basicTypes[typ.Name]; ok {
+			return basic
+		}
+		if c.named[typ.Name] {
+			return &namedType{name: typ.Name}
+		}
+		c.errorf(typ.Token, "unknown type %s", typ.Name)
+	case *ast.ArrayType:
+		return &arrayType{elem: c.resolve(typ.Elem)}
+	case *ast.HashType:
+		return &hashType{key: c.resolve(typ.Key), value: c.resolve(typ.Value)}
+	case *ast.FuncType:
+		fn := &funcType{ret: anyType}
+		for _, arg := range typ.Args {
+			fn.params = append(fn.params, c.resolve(arg))
+			fn.names = append(fn.names, "")
+		}
+		if typ.Return != nil {
+			fn.ret = c.resolve(typ.Return)
+		}
+		return fn
+	}
+	return anyType
+}
+
+func (c *checker) expr(expr ast.Expr, s *scope) Type {
+	switch expr := expr.(type) {
+	case *ast.IntLiteralExpr:
+		return intType
+	case *ast.StringExpr:
+		return stringType
+	case *ast.BoolExpr:
+		return boolType
+	case *ast.NullExpr:
+		return nullType
+	case *ast.RegexExpr:
+		return regexType
+	case *ast.IdentExpr:
+		if b, ok := s.lookup(expr.Value); ok {
+			return b.typ
+		}
+		if builtin, ok := builtins[expr.Value]; ok {
+			return builtin
+		}
+		c.errorf(expr.Token, "unknown identifier %s", expr.Value)
+		return anyType
+	case *ast.PrefixExpr:
+		right := c.expr(expr.Right, s)
+		switch expr.Operator {
+		case "!":
+			return boolType
+		case "-":
+			if !assignable(right, intType) {
+				c.errorf(expr.Token, "invalid operation: %s%s", expr.Operator, right)
+			}
+			return intType
+		default:
+			// `#x` prints x and evaluates to it.
+			return right
+		}
+	case *ast.InfixExpr:
+		return c.infix(expr, c.expr(expr.Left, s), c.expr(expr.Right, s))
+	case *ast.AssignExpr:
+		typ := c.expr(expr.Value, s)
+		c.assign(&expr.Name.Value, expr.Name.Token, typ, s)
+		return typ
+	case *ast.IncDecExpr:
+		c.assign(&expr.Ident.Value, expr.Token, intType, s)
+		return intType
+	case *ast.IfExpr:
+		c.expr(expr.Cond, s)
+		then := c.stmt(expr.Then, s)
+		if expr.Else == nil {
+			return anyType
+		}
+		return join(then, c.stmt(expr.Else, s))
+	case *ast.MatchExpr:
+		c.expr(expr.Subject, s)
+		for _, arm := range expr.Arms {
+			armScope := newScope(s)
+			c.bind(arm.Pattern, anyType, armScope, expr.Token)
+			if arm.Guard != nil {
+				c.expr(arm.Guard, armScope)
+			}
+			c.stmt(arm.Body, armScope)
+		}
+		return anyType
+	case *ast.TryExpr:
+		c.block(expr.Body, s)
+		if expr.Catch != nil {
+			catch := newScope(s)
+			if expr.Param != nil {
+				c.bind(expr.Param, anyType, catch, expr.Token)
+			}
+			c.block(expr.Catch, catch)
+		}
+		c.block(expr.Finally, s)
+		return anyType
+	case *ast.FuncExpr:
+		return c.function(expr, s, "")
+	case *ast.FuncCallExpr:
+		return c.call(expr, s)
+	case *ast.SpawnExpr:
+		c.call(expr.Call, s)
+		return anyType
+	case *ast.SelectExpr:
+		for _, sc := range expr.Cases {
+			caseScope := newScope(s)
+			if sc.Op != nil {
+				c.call(sc.Op, s)
+			}
+			if sc.Binding != nil {
+				c.bind(sc.Binding, anyType, caseScope, expr.Token)
+			}
+			c.stmt(sc.Body, caseScope)
+		}
+		return anyType
+	case *ast.ArrayExpr:
+		var elem Type
+		for _, e := range expr.Elems {
+			if typ := c.expr(e, s); elem == nil {
+				elem = typ
+			} else {
+				elem = join(elem, typ)
+			}
+		}
+		if elem == nil {
+			elem = anyType
+		}
+		return &arrayType{elem: elem}
+	case *ast.ComprehensionExpr:
+		iterable := c.expr(expr.Iterable, s)
+		inner := newScope(s)
+		if len(expr.Vars) == 2 {
+			key, value := c.pair(iterable, expr.Token)
+			c.bind(expr.Vars[0], key, inner, expr.Token)
+			c.bind(expr.Vars[1], value, inner, expr.Token)
+		} else {
+			c.bind(expr.Vars[0], c.elem(iterable, expr.Token), inner, expr.Token)
+		}
+		if expr.Cond != nil {
+			c.expr(expr.Cond, inner)
+		}
+		if expr.Key == nil {
+			return &arrayType{elem: c.expr(expr.Value, inner)}
+		}
+		key := c.expr(expr.Key, inner)
+		return &hashType{key: key, value: c.expr(expr.Value, inner)}
+	case *ast.HashExpr:
+		var key, value Type
+		for _, pair := range expr.Pairs {
+			k, v := c.expr(pair.Key, s), c.expr(pair.Value, s)
+			if key == nil {
+				key, value = k, v
+			} else {
+				key, value = join(key, k), join(value, v)
+			}
+		}
+		if key == nil {
+			key, value = anyType, anyType
+		}
+		return &hashType{key: key, value: value}
+	case *ast.StructLiteralExpr:
+		typ := c.expr(expr.Type, s)
+		for _, field := range expr.Fields {
+			c.expr(field.Value, s)
+		}
+		if st, ok := typ.(*structType); ok {
+			return &namedType{name: st.name}
+		}
+		return anyType
+	case *ast.MemberExpr:
+		c.expr(expr.Object, s)
+		return anyType
+	case *ast.IndexExpr:
+		left, index := c.expr(expr.Left, s), c.expr(expr.Index, s)
+		switch left := left.(type) {
+		case *arrayType:
+			if !assignable(index, intType) {
+				c.errorf(expr.Token, "cannot index %s with %s", left, index)
+			}
+			return left.elem
+		case *hashType:
+			if !assignable(index, left.key) {
+				c.errorf(expr.Token, "cannot index %s with %s", left, index)
+			}
+			return left.value
+		case basicType:
+			if left == stringType {
+				return stringType
+			}
+		}
+		return anyType
+	case *ast.SliceExpr:
+		left := c.expr(expr.Left, s)
+		for _, bound := range []ast.Expr{expr.Start, expr.End, expr.Step} {
+			if bound == nil {
+				continue
+			}
+			if typ := c.expr(bound, s); !assignable(typ, intType) && typ != nullType {
+				c.errorf(expr.Token, "cannot slice %s with %s", left, typ)
+			}
+		}
+		switch left := left.(type) {
+		case *arrayType:
+			return left
+		case basicType:
+			if left == stringType {
+				return stringType
+			}
+		}
+		return anyType
+	}
+	return anyType
+}
+
+// elem returns the type of the values a for loop walks in iterable.
+func (c *checker) elem(iterable Type, tok *token.Token) Type {
+	switch iterable := iterable.(type) {
+	case *arrayType:
+		return iterable.elem
+	case *hashType:
+		return iterable.key
+	case basicType:
+		switch iterable {
+		case stringType:
+			return stringType
+		case intType, boolType, nullType, regexType:
+			c.errorf(tok, "cannot iterate over %s", iterable)
+		}
+	}
+	return anyType
+}
+
+// pair returns the key and value types of a two-variable iteration.
+func (c *checker) pair(iterable Type, tok *token.Token) (Type, Type) {
+	switch iterable := iterable.(type) {
+	case *arrayType:
+		return intType, iterable.elem
+	case *hashType:
+		return iterable.key, iterable.value
+	case basicType:
+		switch iterable {
+		case stringType:
+			return intType, stringType
+		case intType, boolType, nullType, regexType:
+			c.errorf(tok, "cannot iterate over %s with two variables", iterable)
+		}
+	}
+	return anyType, anyType
+}
+
+func (c *checker) infix(expr *ast.InfixExpr, left, right Type) Type {
+	switch expr.Operator {
+	case "==", "!=", "&&", "||":
+		return boolType
+	case "??":
+		if left == nullType {
+			return right
+		}
+		return join(left, right)
+	}
+	_, leftNamed := left.(*namedType)
+	_, rightNamed := right.(*namedType)
+	result := Type(intType)
+	switch expr.Operator {
+	case "<", "<=", ">", ">=":
+		result = boolType
+	}
+	if leftNamed || rightNamed {
+		// Structs can overload operators.
+		if result == boolType {
+			return boolType
+		}
+		return anyType
+	}
+	if !assignable(left, intType) || !assignable(right, intType) {
+		c.errorf(expr.Token, "invalid operation: %s %s %s", left, expr.Operator, right)
+	}
+	return result
+}
+
+func (c *checker) assign(name *string, tok *token.Token, typ Type, s *scope) {
+	b, ok := s.lookup(*name)
+	if !ok {
+		c.errorf(tok, "unknown identifier %s", *name)
+		return
+	}
+	if !b.annotated {
+		// Unannotated variables can hold anything once reassigned.
+		b.typ = anyType
+	} else if !assignable(typ, b.typ) {
+		c.errorf(tok, "cannot assign %s to %s of type %s", typ, *name, b.typ)
+	}
+}
+
+func (c *checker) call(call *ast.FuncCallExpr, s *scope) Type {
+	if ident, ok := call.Func.(*ast.IdentExpr); ok && ident.Value == "quote" && len(call.Args) == 1 {
+		// Quoted code is not evaluated.
+		return anyType
+	}
+	callee := c.expr(call.Func, s)
+	args := make([]Type, len(call.Args))
+	for i, arg := range call.Args {
+		args[i] = c.expr(arg, s)
+	}
+	kwargs := make([]Type, len(call.KwArgs))
+	for i, kwarg := range call.KwArgs {
+		kwargs[i] = c.expr(kwarg.Value, s)
+	}
+	name := call.Func.String()
+	switch fn := callee.(type) {
+	case *funcType:
+		if fn.variadic {
+			return fn.ret
+		}
+		if n := len(args) + len(kwargs); n != len(fn.params) {
+			c.errorf(call.Token, "wrong number of arguments to %s: expected %d, got %d", name, len(fn.params), n)
+			return fn.ret
+		}
+		for i, arg := range args {
+			if !assignable(arg, fn.params[i]) {
+				c.errorf(call.Token, "cannot use %s as %s in argument %d to %s", arg, fn.params[i], i+1, name)
+			}
+		}
+		for i, kwarg := range call.KwArgs {
+			param := indexOf(fn.names, kwarg.Name.Value)
+			if param < 0 {
+				c.errorf(kwarg.Name.Token, "unknown keyword argument %s to %s", kwarg.Name.Value, name)
+			} else if !assignable(kwargs[i], fn.params[param]) {
+				c.errorf(kwarg.Name.Token, "cannot use %s as %s in argument %s to %s", kwargs[i], fn.params[param], kwarg.Name.Value, name)
+			}
+		}
+		return fn.ret
+	case *structType:
+		if n := len(args) + len(kwargs); n != len(fn.fields) {
+			c.errorf(call.Token, "wrong number of fields for %s: expected %d, got %d", fn.name, len(fn.fields), n)
+		}
+		return &namedType{name: fn.name}
+	case basicType:
+		if fn != anyType && !(call.Optional && fn == nullType) {
+			c.errorf(call.Token, "cannot call %s of type %s", name, fn)
+		}
+	case *arrayType, *hashType:
+		c.errorf(call.Token, "cannot call %s of type %s", name, fn)
+	}
+	return anyType
+}
+
+func indexOf(list []string, s string) int {
+	for i, elem := range list {
+		if elem == s {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,90 @@
+package checker
+
+import (
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/token"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x: int = 1;", nil},
+		{"let x: int = \"a\";", []string{"cannot use string as int in let x"}},
+		{"let xs: [int] = [1, 2];\nlet h: {string: [int]} = {\"a\": xs};", nil},
+		{"let xs: [int] = [1, \"a\"];", nil},
+		{"let xs: [string] = [1, 2];", []string{"cannot use [int] as [string] in let xs"}},
+		{"fn add(a: int, b: int) -> int { a + b }\nadd(1, \"2\")\n", []string{"cannot use string as int in argument 2 to add"}},
+		{"fn add(a: int, b: int) -> int { a + b }\nadd(1)\n", []string{"wrong number of arguments to add: expected 2, got 1"}},
+		{"fn f(a: int) { a }\nf(b: 1)\n", []string{"unknown keyword argument b to f"}},
+		{"fn f(a: string) { a }\nf(a: 1)\n", []string{"cannot use int as string in argument a to f"}},
+		{"fn f() -> string { 5 }", []string{"cannot return int from a function returning string"}},
+		{"fn f(n) -> bool { if (n) { return 1 } true }", []string{"cannot return int from a function returning bool"}},
+		{"let s: string = f(1)\nfn f(n: int) -> string { str(n) }\n", nil},
+		{"missing + 1", []string{"unknown identifier missing"}},
+		{"let f = fn() { later() }\nfn later() { 1 }\n", nil},
+		{"\"a\" * 2", []string{"invalid operation: string * int"}},
+		{"let s: string = #\"hello\";", nil},
+		{"let n: int = #\"hello\";", []string{"cannot use string as int in let n"}},
+		{"-\"a\"", []string{"invalid operation: -string"}},
+		{"struct V { x\nfn __mul__(self, n) { V(self.x * n) } }\nV(1) * 2\n", nil},
+		{"struct P { x, y }\nlet p: P = P(1)\n", []string{"wrong number of fields for P: expected 2, got 1"}},
+		{"let p: Q = 1;", []string{"unknown type Q"}},
+		{"let n: int = 0\nn = \"a\"\n", []string{"cannot assign string to n of type int"}},
+		{"let n = 0\nn = \"a\"\nlet s: string = n\n", nil},
+		{"let xs = [1]\nxs[\"a\"]\n", []string{"cannot index [int] with string"}},
+		{"for (x in [\"a\"]) { let n: int = x; }", []string{"cannot use string as int in let n"}},
+		{"let apply = fn(f: fn(int) -> int, x: int) -> int { f(x) }\napply(fn(x) { x }, 1)\napply(1, 1)\n", []string{"cannot use int as fn(int) -> int in argument 1 to apply"}},
+		{"let q = quote(unknown + 1);", nil},
+		{"let m = match 1 { [a, b] => a + b, n => n };", nil},
+		{"let x = 1\nx()\n", []string{"cannot call x of type int"}},
+		{"let port: int = null ?? 80;", nil},
+		{"let n: int = null ?? \"a\";", []string{"cannot use string as int in let n"}},
+		{"let f = null\nf?.()\nf()\n", []string{"cannot call f of type null"}},
+		{"let xs: [int] = [1, 2, 3][1:]\nlet s: string = \"abc\"[::-1]\n", nil},
+		{"let xs: [string] = [1, 2][:1];", []string{"cannot use [int] as [string] in let xs"}},
+		{"[1, 2][\"a\":]", []string{"cannot slice [int] with string"}},
+		{"let xs: [string] = [str(x) for x in [1, 2]]\nlet h: {string: int} = {k: v for k, v in {\"a\": 1}}\n", nil},
+		{"let xs: [int] = [x for x in [\"a\"]];", []string{"cannot use [string] as [int] in let xs"}},
+		{"[x for x, y in 1]", []string{"cannot iterate over int with two variables"}},
+		{"[x for x in [1]]\nx\n", []string{"unknown identifier x"}},
+		{"let r: regex = re\"a+\";\nlet m = r.match(\"aa\");\n", nil},
+		{"let r: string = re\"a+\";", []string{"cannot use regex as string in let r"}},
+	}
+
+	for _, tt := range tests {
+		ch := make(chan *token.Token)
+		p := parser.New(lexer.New(tt.input, ch), ch)
+		prog := p.Parse()
+		if len(p.Errors) > 0 {
+			t.Fatalf("%s: parse error %s", tt.input, p.Errors[0].String())
+		}
+		errs := Check(prog)
+		msgs := make([]string, len(errs))
+		for i, err := range errs {
+			msgs[i] = err.Msg
+		}
+		if strings.Join(msgs, "; ") != strings.Join(tt.expected, "; ") {
+			t.Errorf("%s: expected errors %q, got %q", tt.input, tt.expected, msgs)
+		}
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	ch := make(chan *token.Token)
+	prog := parser.New(lexer.New("let x: int = \"a\"; let y = z;", ch), ch).Parse()
+	errs := Check(prog)
+	if len(errs) != 2 {
+		t.Fatalf("Expected 2 errors, got %d", len(errs))
+	}
+	expected := []string{"Row 1, col 1: cannot use string as int in let x", "Row 1, col 27: unknown identifier z"}
+	for i, err := range errs {
+		if err.String() != expected[i] {
+			t.Errorf("Expected %q, got %q", expected[i], err.String())
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package checker
+
+import "strings"
+
+type Type interface {
+	String() string
+}
+
+type (
+	basicType string
+	arrayType struct{ elem Type }
+	hashType  struct{ key, value Type }
+	funcType  struct {
+		params []Type
+		names  []string // For keyword arguments; empty for non-identifier parameters.
+		ret    Type
+		// Set for builtins taking a variable number of arguments.
+		variadic bool
+	}
+	// structType is a struct declaration, called to build a namedType.
+	structType struct {
+		name   string
+		fields []string
+	}
+	// namedType is an instance of a struct or enum.
+	namedType struct{ name string }
+)
+
+var (
+	anyType    = basicType("any")
+	intType    = basicType("int")
+	stringType = basicType("string")
+	boolType   = basicType("bool")
+	nullType   = basicType("null")
+	regexType  = basicType("regex")
+)
+
+var basicTypes = map[string]Type{
+	"any":    anyType,
+	"int":    intType,
+	"string": stringType,
+	"bool":   boolType,
+	"null":   nullType,
+	"regex":  regexType,
+}
+
+func (t basicType) String() string   { return string(t) }
+func (t *arrayType) String() string  { return "[" + t.elem.String() + "]" }
+func (t *hashType) String() string   { return "{" + t.key.String() + ": " + t.value.String() + "}" }
+func (t *structType) String() string { return "struct " + t.name }
+func (t *namedType) String() string  { return t.name }
+func (t *funcType) String() string {
+	if t.variadic {
+		return "fn(...) -> " + t.ret.String()
+	}
+	params := make([]string, len(t.params))
+	for i, param := range t.params {
+		params[i] = param.String()
+	}
+	return "fn(" + strings.Join(params, ", ") + ") -> " + t.ret.String()
+}
+
+// assignable reports whether a value of type from can be used as a to. Values
+// of unknown type can be used as anything, and anything as an unknown type.
+func assignable(from, to Type) bool {
+	if from == anyType || to == anyType {
+		return true
+	}
+	switch to := to.(type) {
+	case basicType:
+		return from == to
+	case *arrayType:
+		from, ok := from.(*arrayType)
+		return ok && assignable(from.elem, to.elem)
+	case *hashType:
+		from, ok := from.(*hashType)
+		return ok && assignable(from.key, to.key) && assignable(from.value, to.value)
+	case *funcType:
+		from, ok := from.(*funcType)
+		if !ok {
+			return false
+		}
+		if from.variadic || to.variadic {
+			return true
+		}
+		if len(from.params) != len(to.params) || !assignable(from.ret, to.ret) {
+			return false
+		}
+		for i, param := range to.params {
+			if !assignable(param, from.params[i]) {
+				return false
+			}
+		}
+		return true
+	case *structType:
+		from, ok := from.(*structType)
+		return ok && from.name == to.name
+	case *namedType:
+		from, ok := from.(*namedType)
+		return ok && from.name == to.name
+	}
+	return false
+}
+
+// join is the type of a value that is either a or b.
+func join(a, b Type) Type {
+	if a != anyType && b != anyType && assignable(a, b) && assignable(b, a) {
+		return a
+	}
+	return anyType
+}
+
+var builtins = map[string]Type{
+	"type": &funcType{params: []Type{anyType}, names: []string{"x"}, ret: stringType},
+	"str":  &funcType{params: []Type{anyType}, names: []string{"x"}, ret: stringType},
+	"doc":  &funcType{params: []Type{anyType}, names: []string{"f"}, ret: anyType},
+	"chan": &funcType{variadic: true, ret: anyType},
+}
@@ -0,0 +1,74 @@
+package evaluator
+
+import "monkey/object"
+
+var builtins = map[string]*object.ObjBuiltin{
+	"type": {
+		Name: "type",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return errorf(object.ArgumentError, "wrong number of arguments to type: expected 1, got %d", len(args))
+			}
+			if s, ok := args[0].(*object.ObjStruct); ok {
+				return &object.ObjString{Value: s.TypeName()}
+			}
+			return &object.ObjString{Value: args[0].Type().String()}
+		},
+	},
+	"doc": {
+		Name: "doc",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return errorf(object.ArgumentError, "wrong number of arguments to doc: expected 1, got %d", len(args))
+			}
+			var doc string
+			switch fn := args[0].(type) {
+			case *object.ObjFunc:
+				doc = fn.Doc
+			case *object.ObjBoundMethod:
+				doc = fn.Func.Doc
+			}
+			if doc == "" {
+				return nullObj
+			}
+			return &object.ObjString{Value: doc}
+		},
+	},
+	"chan": {
+		Name: "chan",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) > 1 {
+				return errorf(object.ArgumentError, "wrong number of arguments to chan: expected at most 1, got %d", len(args))
+			}
+			ch := &object.ObjChan{}
+			if len(args) == 1 {
+				n, ok := args[0].(*object.ObjInt)
+				if !ok || n.Value < 0 {
+					return errorf(object.TypeError, "chan: capacity must be a non-negative int, got %s", args[0])
+				}
+				ch.Cap = int(n.Value)
+			}
+			return ch
+		},
+	},
+}
+
+// Registered here since Inspect depends on Eval, which refers to builtins.
+func init() {
+	builtins["str"] = &object.ObjBuiltin{
+		Name: "str",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return errorf(object.ArgumentError, "wrong number of arguments to str: expected 1, got %d", len(args))
+			}
+			if s, ok := args[0].(*object.ObjString); ok {
+				return s
+			}
+			str, err := Inspect(args[0])
+			if err != nil {
+				return err
+			}
+			return &object.ObjString{Value: str}
+		},
+	}
+}
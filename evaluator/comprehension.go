@@ -0,0 +1,100 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+)
+
+func evalComprehensionExpr(n *ast.ComprehensionExpr, env object.Env) object.Object {
+	iterable := Eval(n.Iterable, env)
+	if isError(iterable) {
+		return iterable
+	}
+
+	var elems []object.Object
+	hash := object.NewHash()
+	each := func(vals ...object.Object) object.Object {
+		// Like a loop body, every element gets its own scope.
+		scope := object.NewEnv(&env)
+		for i, pattern := range n.Vars {
+			if err := bindPattern(pattern, vals[i], scope, false); err != nil {
+				return err
+			}
+		}
+		if n.Cond != nil {
+			cond := Eval(n.Cond, scope)
+			if isError(cond) {
+				return cond
+			}
+			if !isTruthy(cond) {
+				return nullObj
+			}
+		}
+		if n.Key == nil {
+			val := Eval(n.Value, scope)
+			if isError(val) {
+				return val
+			}
+			elems = append(elems, val)
+			return nullObj
+		}
+		key := Eval(n.Key, scope)
+		if isError(key) {
+			return key
+		}
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return errorf(object.TypeError, "unusable as hash key: %s", key.Type())
+		}
+		val := Eval(n.Value, scope)
+		if isError(val) {
+			return val
+		}
+		hash.Set(hashKey, val)
+		return nullObj
+	}
+
+	var ret object.Object
+	if len(n.Vars) == 2 {
+		ret = iteratePairs(iterable, func(k, v object.Object) object.Object { return each(k, v) })
+	} else {
+		ret = iterate(iterable, func(v object.Object) object.Object { return each(v) })
+	}
+	if ret != nullObj {
+		return at(n.Token, ret)
+	}
+	if n.Key != nil {
+		return hash
+	}
+	return &object.ObjArray{Elems: elems}
+}
+
+// iteratePairs is iterate for two variables, walking the keys and values of a
+// hash, or the indices and elements of an array or string.
+func iteratePairs(obj object.Object, each func(k, v object.Object) object.Object) object.Object {
+	var keys, vals []object.Object
+	switch obj := obj.(type) {
+	case *object.ObjHash:
+		for _, key := range obj.Keys {
+			keys = append(keys, obj.Pairs[key].Key)
+			vals = append(vals, obj.Pairs[key].Value)
+		}
+	case *object.ObjArray:
+		for i, elem := range obj.Elems {
+			keys = append(keys, &object.ObjInt{Value: int64(i)})
+			vals = append(vals, elem)
+		}
+	case *object.ObjString:
+		for _, r := range obj.Value {
+			keys = append(keys, &object.ObjInt{Value: int64(len(keys))})
+			vals = append(vals, &object.ObjString{Value: string(r)})
+		}
+	default:
+		return errorf(object.TypeError, "cannot iterate over %s with two variables", obj.Type())
+	}
+	i := 0
+	return iterate(&object.ObjArray{Elems: keys}, func(key object.Object) object.Object {
+		i++
+		return each(key, vals[i-1])
+	})
+}
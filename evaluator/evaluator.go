@@ -2,16 +2,31 @@ package evaluator
 
 import (
 	"fmt"
+	"io"
 	"monkey/ast"
 	"monkey/object"
+	"monkey/token"
+	"os"
 )
 
 var (
 	nullObj  = &object.ObjNull{}
+	breakObj = &object.ObjBreak{}
+	contObj  = &object.ObjContinue{}
 	trueObj  = &object.ObjBool{Value: true}
 	falseObj = &object.ObjBool{Value: false}
 )
 
+// MaxDepth limits how deeply calls can nest, so runaway recursion fails with a
+// RecursionError instead of overflowing the Go stack. Tail calls don't count.
+var MaxDepth = 10000
+
+// Stdout is where the # operator prints.
+var Stdout io.Writer = os.Stdout
+
+// The number of calls the running task is nested in.
+var depth int
+
 func Eval(n ast.Node, env object.Env) object.Object {
 	if n == nil {
 		return nullObj
@@ -26,26 +41,91 @@ func Eval(n ast.Node, env object.Env) object.Object {
 		if isError(val) {
 			return val
 		}
-		env.Set(n.Name.Value, val)
+		if fn, ok := val.(*object.ObjFunc); ok && fn.Name == "" {
+			if name, ok := untyped(n.Name).(*ast.IdentExpr); ok {
+				fn.Name = name.Value
+				fn.Doc = n.Doc
+			}
+		}
+		if err := bindPattern(n.Name, val, env, n.Token.Type == token.Const); err != nil {
+			return at(n.Token, err)
+		}
 		return nullObj
 
-	case *ast.ReturnStmt:
+	case *ast.ImportStmt:
+		module := importModule(n.Path.Value)
+		if isError(module) {
+			return at(n.Token, module)
+		}
+		if err := bindPattern(n.Alias, module, env, false); err != nil {
+			return err
+		}
+		return nullObj
+
+	case *ast.ExportStmt:
+		return Eval(n.Stmt, env)
+
+	case *ast.DeferStmt:
+		if env.Frame == nil {
+			return at(n.Token, errorf(object.Error, "defer outside of a function"))
+		}
+		call, err := prepareCall(n.Call, env)
+		if err != nil {
+			return err
+		}
+		env.Frame.Defers = append(env.Frame.Defers, call)
+		return nullObj
+
+	case *ast.YieldStmt:
 		val := Eval(n.Value, env)
 		if isError(val) {
 			return val
 		}
-		return &object.ObjReturn{Value: val}
+		if err := env.Frame.Yield(val); err != nil {
+			return err
+		}
+		return nullObj
 
-	case *ast.BlockStmt:
-		newenv := object.NewEnv(&env)
-		for _, stmt := range n.Stmts {
-			switch ret := Eval(*stmt, newenv).(type) {
-			case *object.ObjReturn, *object.ObjError:
-				return ret
+	case *ast.ForStmt:
+		iterable := Eval(n.Iterable, env)
+		if isError(iterable) {
+			return iterable
+		}
+		return at(n.Token, iterate(iterable, func(val object.Object) object.Object {
+			loopenv := object.NewEnv(&env)
+			if err := bindPattern(n.Var, val, loopenv, false); err != nil {
+				return err
 			}
+			return Eval(n.Body, loopenv)
+		}))
+
+	case *ast.BranchStmt:
+		if n.Token.Type == token.Break {
+			return breakObj
+		}
+		return contObj
+
+	case *ast.ThrowStmt:
+		val := Eval(n.Value, env)
+		if isError(val) {
+			return val
+		}
+		return at(n.Token, throw(val))
+
+	case *ast.ReturnStmt:
+		val := evalTail(n.Value, env)
+		switch val.(type) {
+		case *object.ObjReturn, *object.ObjError:
+			return val
 		}
+		return &object.ObjReturn{Value: val}
+
+	case *ast.FuncStmt, *ast.StructStmt, *ast.EnumStmt:
 		return nullObj
 
+	case *ast.BlockStmt:
+		return evalBlockStmt(n, env, false)
+
 	case *ast.ExprStmt:
 		return Eval(n.Expr, env)
 
@@ -53,69 +133,158 @@ func Eval(n ast.Node, env object.Env) object.Object {
 		if val, ok := env.Get(n.Value); ok {
 			return val
 		}
-		return errorf("identifier not found: %s", n.Value)
+		if builtin, ok := builtins[n.Value]; ok {
+			return builtin
+		}
+		return at(n.Token, errorf(object.NameError, "identifier not found: %s", n.Value))
 
 	case *ast.PrefixExpr:
 		right := Eval(n.Right, env)
 		if isError(right) {
 			return right
 		}
-		return evalPrefixExpr(n.Operator, right)
+		return at(n.Token, evalPrefixExpr(n.Operator, right))
+
+	case *ast.AssignExpr:
+		val := Eval(n.Value, env)
+		if isError(val) {
+			return val
+		}
+		return at(n.Token, assign(n.Name, val, env))
+
+	case *ast.IncDecExpr:
+		val, ok := env.Get(n.Ident.Value)
+		if !ok {
+			return at(n.Token, errorf(object.NameError, "identifier not found: %s", n.Ident.Value))
+		}
+		i, ok := val.(*object.ObjInt)
+		if !ok {
+			return at(n.Token, errorf(object.TypeError, "Bad int prefix %s", n.Operator))
+		}
+		if n.Operator == "++" {
+			return at(n.Token, assign(&n.Ident, &object.ObjInt{Value: i.Value + 1}, env))
+		}
+		return at(n.Token, assign(&n.Ident, &object.ObjInt{Value: i.Value - 1}, env))
 
 	case *ast.InfixExpr:
 		left := Eval(n.Left, env)
 		if isError(left) {
 			return left
 		}
+		switch {
+		case n.Operator == "??" && left != nullObj:
+			return left
+		case n.Operator == "??":
+			return Eval(n.Right, env)
+		case n.Operator == "&&" && !isTruthy(left):
+			return falseObj
+		case n.Operator == "||" && isTruthy(left):
+			return trueObj
+		}
 		right := Eval(n.Right, env)
 		if isError(right) {
 			return right
 		}
-		return evalInfixExpr(n.Operator, left, right)
+		return at(n.Token, evalInfixExpr(n.Operator, left, right))
 
 	case *ast.IfExpr:
-		cond := Eval(n.Cond, env)
-		if isError(cond) {
-			return cond
+		return evalIfExpr(n, env, false)
+
+	case *ast.MatchExpr:
+		return evalMatchExpr(n, env, false)
+
+	case *ast.TryExpr:
+		return evalTryExpr(n, env)
+
+	case *ast.FuncExpr:
+		return &object.ObjFunc{
+			Args:      n.Args,
+			Body:      n.BlockStmt,
+			Env:       &env,
+			Generator: n.Generator,
 		}
-		then := Eval(n.Then, env)
-		if isError(then) {
-			return then
+
+	case *ast.MacroExpr:
+		return at(n.Token, errorf(object.Error, "macros can only be defined by a top-level let"))
+
+	case *ast.FuncCallExpr:
+		if isQuote(n) {
+			return quote(n.Args[0], env)
 		}
-		else_ := Eval(n.Else, env)
-		if isError(else_) {
-			return else_
+		call, err := prepareCall(n, env)
+		if err != nil {
+			return err
 		}
+		return call()
 
-		if isTruthy(cond) {
-			return then
+	case *ast.SpawnExpr:
+		call, err := prepareCall(n.Call, env)
+		if err != nil {
+			return err
 		}
-		return else_
+		return spawn(n.Call.Func.String(), call)
 
-	case *ast.FuncExpr:
-		return &object.ObjFunc{
-			Args: n.Args,
-			Body: n.BlockStmt,
-			Env:  &env,
+	case *ast.SelectExpr:
+		return evalSelectExpr(n, env)
+
+	case *ast.ArrayExpr:
+		elems := make([]object.Object, 0, len(n.Elems))
+		for _, elem := range n.Elems {
+			val := Eval(elem, env)
+			if isError(val) {
+				return val
+			}
+			elems = append(elems, val)
 		}
+		return &object.ObjArray{Elems: elems}
 
-	case *ast.FuncCallExpr:
-		fn, ok := Eval(n.Func, env).(*object.ObjFunc)
-		if !ok {
-			return errorf("not a function: %s", n.Func)
+	case *ast.ComprehensionExpr:
+		return evalComprehensionExpr(n, env)
+
+	case *ast.HashExpr:
+		hash := object.NewHash()
+		for _, pair := range n.Pairs {
+			key := Eval(pair.Key, env)
+			if isError(key) {
+				return key
+			}
+			hashKey, ok := key.(object.Hashable)
+			if !ok {
+				return at(n.Token, errorf(object.TypeError, "unusable as hash key: %s", key.Type()))
+			}
+			val := Eval(pair.Value, env)
+			if isError(val) {
+				return val
+			}
+			hash.Set(hashKey, val)
 		}
-		if len(fn.Args) != len(n.Args) {
-			return errorf("mismatched arg count: %s, %s", fn.Args, n.Args)
+		return hash
+
+	case *ast.StructLiteralExpr:
+		typ := Eval(n.Type, env)
+		if isError(typ) {
+			return typ
 		}
-		newenv := object.NewEnv(&env)
-		for i, arg := range fn.Args {
-			callarg := Eval(n.Args[i], env)
-			if isError(callarg) {
-				return callarg
+		structType, ok := typ.(*object.ObjStructType)
+		if !ok {
+			return at(n.Token, errorf(object.TypeError, "not a struct type: %s", typ.Type()))
+		}
+		fields := make([]keywordArg, 0, len(n.Fields))
+		for _, field := range n.Fields {
+			val := Eval(field.Value, env)
+			if isError(val) {
+				return val
 			}
-			newenv.Set(arg.Value, callarg)
+			fields = append(fields, keywordArg{name: field.Name.Value, value: val})
 		}
-		return Eval(fn.Body, newenv)
+		return at(n.Token, newStruct(structType, nil, fields))
+
+	case *ast.MemberExpr, *ast.IndexExpr, *ast.SliceExpr:
+		val, _ := evalChain(n.(ast.Expr), env)
+		return val
+
+	case *ast.NullExpr:
+		return nullObj
 
 	case *ast.IntLiteralExpr:
 		return &object.ObjInt{Value: n.Value}
@@ -129,13 +298,19 @@ func Eval(n ast.Node, env object.Env) object.Object {
 	case *ast.StringExpr:
 		return &object.ObjString{Value: n.Value}
 
+	case *ast.RegexExpr:
+		return &object.ObjRegex{Value: n.Regexp}
+
 	default:
 		panic("Invalid")
 	}
 }
 
 func evalProgram(n *ast.Program, env object.Env) object.Object {
-	var ret object.Object
+	var ret object.Object = nullObj
+	for _, stmt := range n.Stmts {
+		hoistDecl(stmt, env)
+	}
 	for _, stmt := range n.Stmts {
 		ret = Eval(stmt, env)
 		switch ret := ret.(type) {
@@ -145,27 +320,512 @@ func evalProgram(n *ast.Program, env object.Env) object.Object {
 			return ret.Value
 		}
 	}
-	return nil
+	return ret
+}
+
+func hoistDecl(stmt ast.Stmt, env object.Env) {
+	if export, ok := stmt.(*ast.ExportStmt); ok {
+		stmt = export.Stmt
+	}
+	switch stmt := stmt.(type) {
+	case *ast.FuncStmt:
+		env.Set(stmt.Name.Value, &object.ObjFunc{
+			Name:      stmt.Name.Value,
+			Args:      stmt.Func.Args,
+			Body:      stmt.Func.BlockStmt,
+			Env:       &env,
+			Generator: stmt.Func.Generator,
+			Doc:       stmt.Doc,
+		})
+	case *ast.StructStmt:
+		fields := make([]string, len(stmt.Fields))
+		for i, field := range stmt.Fields {
+			fields[i] = field.Value
+		}
+		env.Set(stmt.Name.Value, &object.ObjStructType{
+			Name:    stmt.Name.Value,
+			Fields:  fields,
+			Methods: newMethods(stmt.Name.Value, stmt.Methods, env),
+		})
+	case *ast.EnumStmt:
+		enum := &object.ObjEnum{Name: stmt.Name.Value, Methods: newMethods(stmt.Name.Value, stmt.Methods, env)}
+		for _, variant := range stmt.Variants {
+			fields := make([]string, len(variant.Fields))
+			for i, field := range variant.Fields {
+				fields[i] = field.Value
+			}
+			enum.Variants = append(enum.Variants, &object.ObjStructType{
+				Name:    enum.Name + "." + variant.Name.Value,
+				Fields:  fields,
+				Methods: enum.Methods,
+				Enum:    enum,
+			})
+		}
+		env.Set(stmt.Name.Value, enum)
+	}
+}
+
+func newMethods(typeName string, stmts []*ast.FuncStmt, env object.Env) map[string]*object.ObjFunc {
+	methods := make(map[string]*object.ObjFunc, len(stmts))
+	for _, stmt := range stmts {
+		methods[stmt.Name.Value] = &object.ObjFunc{
+			Name:      typeName + "." + stmt.Name.Value,
+			Args:      stmt.Func.Args,
+			Body:      stmt.Func.BlockStmt,
+			Env:       &env,
+			Generator: stmt.Func.Generator,
+			Doc:       stmt.Doc,
+		}
+	}
+	return methods
+}
+
+type keywordArg struct {
+	name  string
+	value object.Object
+}
+
+// prepareCall evaluates the callee and arguments of a call, returning a
+// function that performs it.
+func prepareCall(n *ast.FuncCallExpr, env object.Env) (func() object.Object, object.Object) {
+	call, err, skipped := evalCall(n, env)
+	if skipped {
+		return func() object.Object { return nullObj }, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return call.apply, nil
+}
+
+// evalChain evaluates a member, index or call expression, reporting whether
+// an optional link such as `a?.b` found null. The rest of the chain is then
+// skipped, and evaluates to null.
+func evalChain(n ast.Expr, env object.Env) (object.Object, bool) {
+	switch n := n.(type) {
+	case *ast.MemberExpr:
+		obj, skipped := evalChain(n.Object, env)
+		if skipped || isError(obj) || n.Optional && obj == nullObj {
+			return obj, skipped || obj == nullObj
+		}
+		return at(n.Token, evalMemberExpr(obj, n.Member.Value)), false
+
+	case *ast.IndexExpr:
+		left, skipped := evalChain(n.Left, env)
+		if skipped || isError(left) || n.Optional && left == nullObj {
+			return left, skipped || left == nullObj
+		}
+		index := Eval(n.Index, env)
+		if isError(index) {
+			return index, false
+		}
+		return at(n.Token, evalIndexExpr(left, index)), false
+
+	case *ast.SliceExpr:
+		left, skipped := evalChain(n.Left, env)
+		if skipped || isError(left) || n.Optional && left == nullObj {
+			return left, skipped || left == nullObj
+		}
+		bounds := make([]object.Object, 3)
+		for i, bound := range []ast.Expr{n.Start, n.End, n.Step} {
+			bounds[i] = nullObj
+			if bound != nil {
+				if bounds[i] = Eval(bound, env); isError(bounds[i]) {
+					return bounds[i], false
+				}
+			}
+		}
+		return at(n.Token, evalSliceExpr(left, bounds[0], bounds[1], bounds[2])), false
+
+	case *ast.FuncCallExpr:
+		call, err, skipped := evalCall(n, env)
+		if skipped {
+			return nullObj, true
+		}
+		if err != nil {
+			return err, false
+		}
+		return call.apply(), false
+
+	default:
+		return Eval(n, env), false
+	}
+}
+
+// evalTail evaluates n in tail position, where the function's result is n's
+// value. A call there is left pending in an ObjReturn, as if returned.
+func evalTail(n ast.Node, env object.Env) object.Object {
+	switch n := n.(type) {
+	case *ast.BlockStmt:
+		return evalBlockStmt(n, env, true)
+	case *ast.ExprStmt:
+		return evalTail(n.Expr, env)
+	case *ast.IfExpr:
+		return evalIfExpr(n, env, true)
+	case *ast.MatchExpr:
+		return evalMatchExpr(n, env, true)
+	case *ast.FuncCallExpr:
+		if !isTailCall(n, env) {
+			break
+		}
+		pending, err, skipped := evalCall(n, env)
+		if skipped {
+			return &object.ObjReturn{Value: nullObj}
+		}
+		if err != nil {
+			return err
+		}
+		return &object.ObjReturn{Value: pending}
+	}
+	return Eval(n, env)
+}
+
+func evalBlockStmt(n *ast.BlockStmt, env object.Env, tail bool) object.Object {
+	newenv := object.NewEnv(&env)
+	for _, stmt := range n.Stmts {
+		hoistDecl(*stmt, newenv)
+	}
+	var ret object.Object = nullObj
+	for i, stmt := range n.Stmts {
+		if last, ok := (*stmt).(*ast.ExprStmt); ok && tail && i == len(n.Stmts)-1 && !last.Discard {
+			ret = evalTail(last, newenv)
+		} else {
+			ret = Eval(*stmt, newenv)
+		}
+		switch ret.(type) {
+		case *object.ObjReturn, *object.ObjError, *object.ObjBreak, *object.ObjContinue:
+			return ret
+		}
+	}
+	if len(n.Stmts) > 0 {
+		if last, ok := (*n.Stmts[len(n.Stmts)-1]).(*ast.ExprStmt); ok && last.Discard {
+			return nullObj
+		}
+	}
+	return ret
+}
+
+func evalIfExpr(n *ast.IfExpr, env object.Env, tail bool) object.Object {
+	cond := Eval(n.Cond, env)
+	if isError(cond) {
+		return cond
+	}
+	branch := n.Else
+	if isTruthy(cond) {
+		branch = n.Then
+	}
+	if tail {
+		return evalTail(branch, env)
+	}
+	return Eval(branch, env)
+}
+
+func evalMatchExpr(n *ast.MatchExpr, env object.Env, tail bool) object.Object {
+	subject := Eval(n.Subject, env)
+	if isError(subject) {
+		return subject
+	}
+	for _, arm := range n.Arms {
+		armenv := object.NewEnv(&env)
+		if err := bindPattern(arm.Pattern, subject, armenv, false); err != nil {
+			if err.Kind != object.MatchError {
+				return at(n.Token, err)
+			}
+			continue
+		}
+		if arm.Guard != nil {
+			guard := Eval(arm.Guard, armenv)
+			if isError(guard) {
+				return guard
+			}
+			if !isTruthy(guard) {
+				continue
+			}
+		}
+		if tail {
+			return evalTail(arm.Body, armenv)
+		}
+		return Eval(arm.Body, armenv)
+	}
+	return at(n.Token, errorf(object.MatchError, "no match arm for value: %s", subject))
+}
+
+// pendingCall is a call whose callee and arguments have been evaluated. As the
+// value of a `return f(x)` or a call in tail position, it is a tail call, made by applyUserFunc once the
+// returning function's frame is gone.
+type pendingCall struct {
+	tok    *token.Token
+	callee object.Object
+	args   []object.Object
+	kwargs []keywordArg
+}
+
+func (c *pendingCall) Type() object.ObjectType { return object.ObjTypeReturn }
+func (c *pendingCall) String() string          { return "call to " + c.callee.String() }
+
+func (c *pendingCall) apply() object.Object {
+	return at(c.tok, applyFunc(c.callee, c.args, c.kwargs))
+}
+
+// evalCall evaluates the callee and arguments of a call, reporting whether an
+// optional link skipped it.
+func evalCall(n *ast.FuncCallExpr, env object.Env) (*pendingCall, object.Object, bool) {
+	callee, skipped := evalChain(n.Func, env)
+	if skipped || n.Optional && callee == nullObj {
+		return nil, nil, true
+	}
+	if isError(callee) {
+		return nil, callee, false
+	}
+	call := &pendingCall{tok: n.Token, callee: callee}
+	for _, arg := range n.Args {
+		callarg := Eval(arg, env)
+		if isError(callarg) {
+			return nil, callarg, false
+		}
+		call.args = append(call.args, callarg)
+	}
+	for _, kwarg := range n.KwArgs {
+		callarg := Eval(kwarg.Value, env)
+		if isError(callarg) {
+			return nil, callarg, false
+		}
+		call.kwargs = append(call.kwargs, keywordArg{name: kwarg.Name.Value, value: callarg})
+	}
+	return call, nil, false
+}
+
+// isTailCall reports whether a call in tail position can return before making the call.
+// It can't in a try expression, which must catch its errors, nor before
+// deferred calls, which must run after it.
+func isTailCall(call *ast.FuncCallExpr, env object.Env) bool {
+	frame := env.Frame
+	return frame != nil && frame.TailCalls && frame.Tries == 0 && len(frame.Defers) == 0 && !isQuote(call)
+}
+
+func applyFunc(callee object.Object, args []object.Object, kwargs []keywordArg) object.Object {
+	switch fn := callee.(type) {
+	case *object.ObjFunc:
+		return applyUserFunc(fn, args, kwargs)
+	case *object.ObjStructType:
+		return newStruct(fn, args, kwargs)
+	case *object.ObjBoundMethod:
+		return applyUserFunc(fn.Func, append([]object.Object{fn.Self}, args...), kwargs)
+	case *object.ObjStruct:
+		if call, ok := findMethod(fn, "__call__"); ok {
+			return applyUserFunc(call, append([]object.Object{fn}, args...), kwargs)
+		}
+		return errorf(object.TypeError, "not a function: %s", fn.TypeName())
+	case *object.ObjBuiltin:
+		if len(kwargs) > 0 {
+			return errorf(object.ArgumentError, "%s does not take keyword arguments", fn.Name)
+		}
+		return fn.Fn(args...)
+	default:
+		return errorf(object.TypeError, "not a function: %s", callee.Type())
+	}
+}
+
+func applyUserFunc(fn *object.ObjFunc, args []object.Object, kwargs []keywordArg) object.Object {
+	if depth >= MaxDepth {
+		return errorf(object.RecursionError, "maximum recursion depth exceeded")
+	}
+	depth++
+	defer func() { depth-- }()
+
+	// Tail calls to functions and methods reuse this loop, so they don't
+	// grow the Go stack. The functions they replaced are kept for stack traces,
+	// with consecutive calls to the same function counted once.
+	var tok *token.Token
+	var callers []string
+	var calls []int
+	for {
+		ret := callUserFunc(fn, args, kwargs)
+		call, ok := ret.(*pendingCall)
+		if !ok {
+			if err, ok := ret.(*object.ObjError); ok {
+				for i := len(callers) - 1; i >= 0; i-- {
+					for n := 0; n < calls[i]; n++ {
+						err.Stack = append(err.Stack, callers[i])
+					}
+				}
+			}
+			if tok != nil {
+				return at(tok, ret)
+			}
+			return ret
+		}
+		if name := funcName(fn); len(callers) > 0 && callers[len(callers)-1] == name {
+			calls[len(calls)-1]++
+		} else {
+			callers, calls = append(callers, name), append(calls, 1)
+		}
+		tok, args, kwargs = call.tok, call.args, call.kwargs
+		switch callee := call.callee.(type) {
+		case *object.ObjFunc:
+			fn = callee
+		case *object.ObjBoundMethod:
+			fn, args = callee.Func, append([]object.Object{callee.Self}, args...)
+		default:
+			return call.apply()
+		}
+	}
+}
+
+func callUserFunc(fn *object.ObjFunc, args []object.Object, kwargs []keywordArg) object.Object {
+	params := make([]string, len(fn.Args))
+	for i, arg := range fn.Args {
+		params[i] = untyped(arg).String()
+	}
+	bound, err := bindArgs(params, args, kwargs)
+	if err != nil {
+		return err
+	}
+	newenv := object.NewEnv(fn.Env)
+	newenv.Frame = &object.Frame{TailCalls: !fn.Generator}
+	for i, arg := range fn.Args {
+		if err := bindPattern(arg, bound[i], newenv, false); err != nil {
+			return err
+		}
+	}
+	if fn.Generator {
+		return newGenerator(fn, newenv)
+	}
+	return runBody(fn, newenv)
+}
+
+func runBody(fn *object.ObjFunc, newenv object.Env) object.Object {
+	ret := evalTail(fn.Body, newenv)
+	// As in Go, deferred calls run last-in first-out, and an error in one
+	// replaces the result.
+	for i := len(newenv.Frame.Defers) - 1; i >= 0; i-- {
+		if deferred := newenv.Frame.Defers[i](); isError(deferred) {
+			ret = deferred
+		}
+	}
+	switch ret := ret.(type) {
+	case *object.ObjReturn:
+		return ret.Value
+	case *object.ObjError:
+		ret.Stack = append(ret.Stack, funcName(fn))
+		return ret
+	default:
+		return ret
+	}
+}
+
+func funcName(fn *object.ObjFunc) string {
+	if fn.Name == "" {
+		return "<anonymous>"
+	}
+	return fn.Name
+}
+
+func newStruct(typ *object.ObjStructType, args []object.Object, fields []keywordArg) object.Object {
+	if len(args) > len(typ.Fields) {
+		return errorf(object.ArgumentError, "too many fields for %s: expected %d, got %d", typ.Name, len(typ.Fields), len(args))
+	}
+	values := make([]object.Object, len(typ.Fields))
+	copy(values, args)
+	for _, field := range fields {
+		i := indexOf(typ.Fields, field.name)
+		if i < 0 {
+			return errorf(object.NameError, "%s has no field %s", typ.Name, field.name)
+		}
+		if values[i] != nil {
+			return errorf(object.ArgumentError, "field %s of %s set more than once", field.name, typ.Name)
+		}
+		values[i] = field.value
+	}
+	for i, val := range values {
+		if val == nil {
+			return errorf(object.ArgumentError, "missing field %s for %s", typ.Fields[i], typ.Name)
+		}
+	}
+	return &object.ObjStruct{StructType: typ, Values: values}
+}
+
+func bindArgs(params []string, args []object.Object, kwargs []keywordArg) ([]object.Object, *object.ObjError) {
+	if len(args) > len(params) {
+		return nil, errorf(object.ArgumentError, "too many arguments: expected %d, got %d", len(params), len(args))
+	}
+	bound := make([]object.Object, len(params))
+	copy(bound, args)
+	for _, kwarg := range kwargs {
+		i := indexOf(params, kwarg.name)
+		if i < 0 {
+			return nil, errorf(object.ArgumentError, "unknown keyword argument: %s", kwarg.name)
+		}
+		if bound[i] != nil {
+			return nil, errorf(object.ArgumentError, "argument bound more than once: %s", kwarg.name)
+		}
+		bound[i] = kwarg.value
+	}
+	for i, val := range bound {
+		if val == nil {
+			return nil, errorf(object.ArgumentError, "missing argument: %s", params[i])
+		}
+	}
+	return bound, nil
+}
+
+func indexOf(list []string, s string) int {
+	for i, elem := range list {
+		if elem == s {
+			return i
+		}
+	}
+	return -1
+}
+
+func assign(ident *ast.IdentExpr, val object.Object, env object.Env) object.Object {
+	b, ok := env.Resolve(ident.Value)
+	if !ok {
+		return errorf(object.NameError, "identifier not found: %s", ident.Value)
+	}
+	if b.Const {
+		return errorf(object.ConstError, "cannot assign to constant %s%s", ident.Value, declaredAt(b))
+	}
+	b.Value = val
+	return val
+}
+
+func declaredAt(b *object.Binding) string {
+	if b.Token == nil {
+		return ""
+	}
+	return fmt.Sprintf(" (declared at row %d, col %d)", b.Token.Row, b.Token.Col)
 }
 
 func evalPrefixExpr(op string, right object.Object) object.Object {
 	switch op {
 	case "-":
 		if right.Type() != object.ObjTypeInt {
-			return errorf("Bad int prefix %s", op)
+			return errorf(object.TypeError, "Bad int prefix %s", op)
 		}
 		return &object.ObjInt{Value: -right.(*object.ObjInt).Value}
 	case "!":
 		return getBool(!isTruthy(right))
 	case "#":
-		fmt.Print(right.String())
+		str, err := Inspect(right)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(Stdout, str)
 		return right
 	default:
-		return errorf("Bad prefix %s", op)
+		return errorf(object.TypeError, "Bad prefix %s", op)
 	}
 }
 
 func evalInfixExpr(op string, left, right object.Object) object.Object {
+	switch {
+	case op == "&&" || op == "||":
+		return getBool(isTruthy(right))
+	}
+	if ret, ok := evalInfixHook(op, left, right); ok {
+		return ret
+	}
 	switch {
 	case left.Type() == object.ObjTypeInt && right.Type() == object.ObjTypeInt:
 		leftVal := left.(*object.ObjInt).Value
@@ -177,9 +837,13 @@ func evalInfixExpr(op string, left, right object.Object) object.Object {
 			return &object.ObjInt{Value: leftVal - rightVal}
 		case "*":
 			return &object.ObjInt{Value: leftVal * rightVal}
-		case "/":
-			return &object.ObjInt{Value: leftVal / rightVal}
-		case "%":
+		case "/", "%":
+			if rightVal == 0 {
+				return errorf(object.ArithmeticError, "division by zero")
+			}
+			if op == "/" {
+				return &object.ObjInt{Value: leftVal / rightVal}
+			}
 			return &object.ObjInt{Value: leftVal % rightVal}
 		case "==":
 			return getBool(leftVal == rightVal)
@@ -194,15 +858,195 @@ func evalInfixExpr(op string, left, right object.Object) object.Object {
 		case ">=":
 			return getBool(leftVal >= rightVal)
 		default:
-			return errorf("Bad int operator %q", op)
+			return errorf(object.TypeError, "Bad int operator %q", op)
+		}
+	case op == "==" || op == "!=":
+		eq, err := objectsEqual(left, right)
+		if err != nil {
+			return err
+		}
+		return getBool(eq == (op == "=="))
+	default:
+		return errorf(object.TypeError, "Bad expression: %s %s %s", left, op, right)
+	}
+}
+
+// objectsEqual compares by value, failing if a user __eq__ hook does.
+func objectsEqual(left, right object.Object) (bool, *object.ObjError) {
+	if left.Type() != right.Type() {
+		return false, nil
+	}
+	switch left := left.(type) {
+	case *object.ObjInt:
+		return left.Value == right.(*object.ObjInt).Value, nil
+	case *object.ObjBool:
+		return left.Value == right.(*object.ObjBool).Value, nil
+	case *object.ObjString:
+		return left.Value == right.(*object.ObjString).Value, nil
+	case *object.ObjNull:
+		return true, nil
+	case *object.ObjArray:
+		right := right.(*object.ObjArray)
+		if len(left.Elems) != len(right.Elems) {
+			return false, nil
+		}
+		for i := range left.Elems {
+			if eq, err := objectsEqual(left.Elems[i], right.Elems[i]); !eq || err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	case *object.ObjHash:
+		right := right.(*object.ObjHash)
+		if len(left.Pairs) != len(right.Pairs) {
+			return false, nil
+		}
+		for key, pair := range left.Pairs {
+			other, ok := right.Pairs[key]
+			if !ok {
+				return false, nil
+			}
+			if eq, err := objectsEqual(pair.Value, other.Value); !eq || err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	case *object.ObjStruct:
+		if eq, ok := callHook(left, "__eq__", right); ok {
+			if err, ok := eq.(*object.ObjError); ok {
+				return false, err
+			}
+			return isTruthy(eq), nil
+		}
+		right := right.(*object.ObjStruct)
+		if left.StructType != right.StructType {
+			return false, nil
+		}
+		for i := range left.Values {
+			if eq, err := objectsEqual(left.Values[i], right.Values[i]); !eq || err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	default:
+		return left == right, nil
+	}
+}
+
+func evalIndexExpr(left, index object.Object) object.Object {
+	if ret, ok := callHook(left, "__index__", index); ok {
+		return ret
+	}
+	switch left := left.(type) {
+	case *object.ObjArray:
+		i, ok := index.(*object.ObjInt)
+		if !ok {
+			return errorf(object.TypeError, "array index must be int, got %s", index.Type())
+		}
+		if i.Value < 0 || i.Value >= int64(len(left.Elems)) {
+			return nullObj
+		}
+		return left.Elems[i.Value]
+	case *object.ObjHash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return errorf(object.TypeError, "unusable as hash key: %s", index.Type())
+		}
+		if val, ok := left.Get(key); ok {
+			return val
+		}
+		return nullObj
+	default:
+		return errorf(object.TypeError, "index operator not supported: %s", left.Type())
+	}
+}
+
+func evalSliceExpr(left, start, end, step object.Object) object.Object {
+	switch left := left.(type) {
+	case *object.ObjArray:
+		indices, err := sliceIndices(len(left.Elems), start, end, step)
+		if err != nil {
+			return err
+		}
+		elems := make([]object.Object, len(indices))
+		for i, index := range indices {
+			elems[i] = left.Elems[index]
+		}
+		return &object.ObjArray{Elems: elems}
+	case *object.ObjString:
+		runes := []rune(left.Value)
+		indices, err := sliceIndices(len(runes), start, end, step)
+		if err != nil {
+			return err
 		}
+		sliced := make([]rune, len(indices))
+		for i, index := range indices {
+			sliced[i] = runes[index]
+		}
+		return &object.ObjString{Value: string(sliced)}
 	default:
-		return errorf("Bad expression: %s %s %s", left, op, right)
+		return errorf(object.TypeError, "slice operator not supported: %s", left.Type())
+	}
+}
+
+// sliceIndices returns the indices selected by a slice of a sequence of
+// length n. As in Python, negative bounds count from the end, out of range
+// bounds are clamped, and null bounds are omitted.
+func sliceIndices(n int, start, end, step object.Object) ([]int, *object.ObjError) {
+	bound := func(obj object.Object, def int64) (int64, *object.ObjError) {
+		switch obj := obj.(type) {
+		case *object.ObjNull:
+			return def, nil
+		case *object.ObjInt:
+			return obj.Value, nil
+		default:
+			return 0, errorf(object.TypeError, "slice index must be int, got %s", obj.Type())
+		}
+	}
+	clamp := func(i, lo, hi int64) int64 {
+		if i < 0 {
+			i += int64(n)
+		}
+		if i < lo {
+			return lo
+		}
+		if i > hi {
+			return hi
+		}
+		return i
+	}
+
+	by, err := bound(step, 1)
+	if err != nil {
+		return nil, err
+	}
+	if by == 0 {
+		return nil, errorf(object.ArgumentError, "slice step cannot be zero")
+	}
+	// Stepping backwards, a slice runs from the last element to before the first.
+	from, to, lo, hi := int64(0), int64(n), int64(0), int64(n)
+	if by < 0 {
+		from, to, lo, hi = int64(n-1), -1-int64(n), -1, int64(n-1)
+	}
+	if from, err = bound(start, from); err != nil {
+		return nil, err
+	}
+	if to, err = bound(end, to); err != nil {
+		return nil, err
+	}
+	from, to = clamp(from, lo, hi), clamp(to, lo, hi)
+
+	var indices []int
+	for i := from; by > 0 && i < to || by < 0 && i > to; i += by {
+		indices = append(indices, int(i))
 	}
+	return indices, nil
 }
 
 func isTruthy(o object.Object) bool {
 	switch o := o.(type) {
+	case *object.ObjNull:
+		return false
 	case *object.ObjInt:
 		return o.Value != 0
 	case *object.ObjBool:
@@ -224,6 +1068,6 @@ func isError(o object.Object) bool {
 	return o.Type() == object.ObjTypeError
 }
 
-func errorf(msg string, a ...interface{}) *object.ObjError {
-	return &object.ObjError{Error: fmt.Sprintf(msg, a...)}
+func errorf(kind, msg string, a ...interface{}) *object.ObjError {
+	return &object.ObjError{Error: fmt.Sprintf(msg, a...), Kind: kind}
 }
@@ -1,6 +1,9 @@
 package evaluator
 
 import (
+	"bytes"
+	"io"
+	"io/ioutil"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
@@ -50,3 +53,832 @@ func TestFuncCall(t *testing.T) {
 		}
 	}
 }
+
+func TestKeywordArgs(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let sub = fn(x, y) { return x-y; }; sub(y: 1, x: 5)", "4"},
+		{"let sub = fn(x, y) { return x-y; }; sub(5, y: 2)", "3"},
+		{"let f = fn(a, b, c) { return a*100 + b*10 + c; }; f(1, c: 3, b: 2)", "123"},
+		{"let f = fn(x) { return x; }; f(z: 1)", "<Error: unknown keyword argument: z>"},
+		{"let f = fn(x) { return x; }; f(1, x: 2)", "<Error: argument bound more than once: x>"},
+		{"let f = fn(x) { return x; }; f(x: 1, x: 2)", "<Error: argument bound more than once: x>"},
+		{"let f = fn(x, y) { return x; }; f(y: 1)", "<Error: missing argument: x>"},
+		{"let f = fn(x) { return x; }; f(1, 2)", "<Error: too many arguments: expected 1, got 2>"},
+	}
+	for _, tt := range tests {
+		output := testEval(tt.input).String()
+		if output != tt.expected {
+			t.Errorf("Expected output %q, got %q", tt.expected, output)
+		}
+	}
+}
+
+func TestArraysAndHashes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2 * 3, \"a\"]", "[1, 6, \"a\"]"},
+		{"[1, 2, 3][1]", "2"},
+		{"[1, 2, 3][3]", "null"},
+		{"let h = {\"a\": 1, 2: true}; h", "{\"a\": 1, 2: true}"},
+		{"let h = {\"a\": 1, true: 2}; h[\"a\"] + h[true]", "3"},
+		{"let h = {\"a\": 1}; h[\"b\"]", "null"},
+		{"let h = {[1]: 2};", "<Error: unusable as hash key: array>"},
+		{"1[0]", "<Error: index operator not supported: int>"},
+	}
+	for _, tt := range tests {
+		output := testEval(tt.input).String()
+		if output != tt.expected {
+			t.Errorf("Expected output %q, got %q", tt.expected, output)
+		}
+	}
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let [a, b] = [1, 2]; a * 10 + b", "12"},
+		{"let [a, ...rest] = [1, 2, 3]; rest", "[2, 3]"},
+		{"let [a, ...rest] = [1]; rest", "[]"},
+		{"let {name, age: years} = {\"name\": \"x\", \"age\": 3}; [name, years]", "[\"x\", 3]"},
+		{"let [a, {b: [c]}] = [1, {\"b\": [2]}]; a + c", "3"},
+		{"let f = fn([x, y], {z}) { return x + y + z; }; f([1, 2], {\"z\": 3})", "6"},
+		{"let [a, b] = [1, 2, 3];", "<Error: pattern [a, b]: expected 2 elements, got 3>"},
+		{"let [a, [b, c]] = [1, 2];", "<Error: pattern [b, c]: expected array, got int>"},
+		{"let {name} = {\"age\": 3};", "<Error: pattern {name}: missing key \"name\">"},
+	}
+	for _, tt := range tests {
+		output := testEval(tt.input).String()
+		if output != tt.expected {
+			t.Errorf("Expected output %q, got %q", tt.expected, output)
+		}
+	}
+}
+
+func TestMatchExpr(t *testing.T) {
+	describe := `let describe = fn(v) {
+		return match (v) {
+			0 => "zero",
+			-1 => "minus one",
+			[x, y] => x + y,
+			[_, ...rest] => rest,
+			{kind: "a", n} => n,
+			n if n == 42 || n == 43 => "answer",
+			"str" => "string",
+			true => "true",
+		};
+	};
+	`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"describe(0)", "\"zero\""},
+		{"describe(-1)", "\"minus one\""},
+		{"describe([1, 2])", "3"},
+		{"describe([1, 2, 3])", "[2, 3]"},
+		{"describe({\"kind\": \"a\", \"n\": 5})", "5"},
+		{"describe(42)", "\"answer\""},
+		{"describe(\"str\")", "\"string\""},
+		{"describe(true)", "\"true\""},
+		{"describe(5)", "<Error: no match arm for value: 5>"},
+		{"describe({\"kind\": \"b\", \"n\": 5})", "<Error: no match arm for value: {\"kind\": \"b\", \"n\": 5}>"},
+		{"match (3) { _ => 1 }", "1"},
+		{"match (12) { n if n > 10 && n < 100 => n }", "12"},
+	}
+	for _, tt := range tests {
+		output := testEval(describe + tt.input).String()
+		if output != tt.expected {
+			t.Errorf("%s: expected output %q, got %q", tt.input, tt.expected, output)
+		}
+	}
+}
+
+func TestLambda(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let double = x => x * 2; double(4)", "8"},
+		{"let add = (x, y) => x + y; add(1, 2)", "3"},
+		{"let sum = |[x, y]| x + y; sum([3, 4])", "7"},
+		{"let apply = fn(f, x) { return f(x); }; apply(x => x - 1, 10)", "9"},
+		{"let adder = x => y => x + y; adder(2)(3)", "5"},
+		{"(|| 42)()", "42"},
+	}
+	for _, tt := range tests {
+		output := testEval(tt.input).String()
+		if output != tt.expected {
+			t.Errorf("%s: expected output %q, got %q", tt.input, tt.expected, output)
+		}
+	}
+}
+
+func TestMemberExpr(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let h = {"name": "x", "len": 5}; h.name`, `"x"`},
+		{`let h = {"len": 5}; h.len`, `5`},
+		{`let h = {"a": 1, "b": 2}; h.keys()`, `["a", "b"]`},
+		{`let h = {"a": 1}; [h.has("a"), h.has("b")]`, `[true, false]`},
+		{`"abc".upper()`, `"ABC"`},
+		{`"日本語".len()`, `3`},
+		{`"a,b".split(",")`, `["a", "b"]`},
+		{`let xs = [1]; xs.push(2); xs.push(3); xs`, `[1, 2, 3]`},
+		{`let xs = [1, 2]; [xs.pop(), xs]`, `[2, [1]]`},
+		{`[1, 2, 3].join("-")`, `"1-2-3"`},
+		{`let up = "abc".upper; up()`, `"ABC"`},
+		{`5.upper()`, `<Error: unknown member upper for int>`},
+		{`"abc".upper(1)`, `<Error: wrong number of arguments to string.upper: expected 0, got 1>`},
+		{`"abc".split(x: ",")`, `<Error: string.split does not take keyword arguments>`},
+	}
+	for _, tt := range tests {
+		output := testEval(tt.input).String()
+		if output != tt.expected {
+			t.Errorf("%s: expected output %q, got %q", tt.input, tt.expected, output)
+		}
+	}
+}
+
+func TestConstBindings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 1; x = 2; x", "2"},
+		{"let x = 1; let inc = fn() { x = x + 1; }; inc(); inc(); x", "3"},
+		{"let x = 1; ++x; --x; ++x", "2"},
+		{"const x = 1; x", "1"},
+		{"const x = 1; let f = fn() { let x = 2; return x; }; f()", "2"},
+		{"const x = 1;\nx = 2", "<Error: cannot assign to constant x (declared at row 1, col 7)>"},
+		{"const x = 1; let f = fn() { x = 2; }; f()", "<Error: cannot assign to constant x (declared at row 1, col 7)>"},
+		{"const x = 1; let x = 2;", "<Error: cannot redeclare constant x (declared at row 1, col 7)>"},
+		{"const [a, b] = [1, 2]; ++b", "<Error: cannot assign to constant b (declared at row 1, col 11)>"},
+		{"y = 1", "<Error: identifier not found: y>"},
+	}
+	for _, tt := range tests {
+		output := testEval(tt.input).String()
+		if output != tt.expected {
+			t.Errorf("%s: expected output %q, got %q", tt.input, tt.expected, output)
+		}
+	}
+}
+
+func TestFuncDecl(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn add(a, b) { return a + b; } add(1, 2)", "3"},
+		{"let r = twice(2); fn twice(x) { return x * 2; } r", "4"},
+		{`let r = isEven(10)
+		fn isEven(n) { if (n == 0) { return true; } return isOdd(n - 1); }
+		fn isOdd(n) { if (n == 0) { return false; } return isEven(n - 1); }
+		r`, "true"},
+		{"let f = fn() { return inner(); fn inner() { return 1; } }; f()", "1"},
+		{"fn add(a, b) { return a + b; } add", "<function add>"},
+		{"let sub = fn(a, b) { return a - b; }; sub", "<function sub>"},
+		{"fn(x) { return x; }", "<function>"},
+		{"fn f() { } inner", "<Error: identifier not found: inner>"},
+	}
+	for _, tt := range tests {
+		output := testEval(tt.input).String()
+		if output != tt.expected {
+			t.Errorf("%s: expected output %q, got %q", tt.input, tt.expected, output)
+		}
+	}
+
+	input := `fn outer() { return inner(); }
+	fn inner() { return missing; }
+	outer()`
+	err, ok := testEval(input).(*object.ObjError)
+	if !ok {
+		t.Fatalf("Expected error, got %T", err)
+	}
+	expected := "<Error: identifier not found: missing>\n    in inner\n    in outer"
+	if trace := err.Trace(); trace != expected {
+		t.Errorf("Expected trace %q, got %q", expected, trace)
+	}
+}
+
+func TestBlockValues(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"if (true) { 1 } else { 2 }", "1"},
+		{"if (false) { 1 } else { 2 }", "2"},
+		{"if (false) { 1 }", "null"},
+		{"let f = fn(x) { x * 2 }; f(3)", "6"},
+		{"let f = fn(x) { x * 2; }; f(3)", "null"},
+		{"let f = fn(x) { let y = x; }; f(3)", "null"},
+		{"let f = fn(x) {\n\tlet y = x + 1\n\ty * 2\n}\nf(1)", "4"},
+		{"fn abs(n) { if (n < 0) { -n } else { n } } abs(-3)", "3"},
+		{"fn f() { return 1; 2 } f()", "1"},
+		{"let x = match (1) { 1 => { 10 } }; x", "10"},
+	}
+	for _, tt := range tests {
+		output := testEval(tt.input).String()
+		if output != tt.expected {
+			t.Errorf("%s: expected output %q, got %q", tt.input, tt.expected, output)
+		}
+	}
+}
+
+func TestModules(t *testing.T) {
+	dir, lib := t.TempDir(), t.TempDir()
+	files := map[string]string{
+		dir + "/util.monkey":  "export fn double(x) { x * 2 }\nexport let [one, two] = [1, 2]\nlet secret = 3\n",
+		dir + "/a.monkey":     "import \"b\" as b\n",
+		dir + "/b.monkey":     "import \"a\" as a\n",
+		dir + "/count.monkey": "let n = 0\nexport fn next() { n = n + 1 }\n",
+		dir + "/state.monkey": "export let n = 1\nexport fn inc() { n = n + 1 }\nexport fn get() { n }\n",
+		lib + "/std.monkey":   "export let name = \"std\"\n",
+	}
+	for file, src := range files {
+		if err := ioutil.WriteFile(file, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("MONKEYPATH", lib)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import "util" as u; u.double(u.two)`, "4"},
+		{`import "util.monkey"; util.one`, "1"},
+		{`import "std"; std.name`, `"std"`},
+		{`import "count" as c1; import "count" as c2; c1.next(); c2.next()`, "2"},
+		{`import "state" as m; m.inc(); [m.n, m.get()]`, "[2, 2]"},
+		{`import "util"; util.secret`, "<Error: module util has no export secret>"},
+		{`import "missing";`, "<Error: module not found: missing.monkey>"},
+	}
+	for _, tt := range tests {
+		ch := make(chan *token.Token)
+		program := parser.New(lexer.New(tt.input, ch), ch).Parse()
+		output := EvalModule(program, dir+"/main.monkey", object.NewEnv(nil)).String()
+		if output != tt.expected {
+			t.Errorf("%s: expected output %q, got %q", tt.input, tt.expected, output)
+		}
+	}
+
+	ch := make(chan *token.Token)
+	program := parser.New(lexer.New(`import "a";`, ch), ch).Parse()
+	err, ok := EvalModule(program, dir+"/main.monkey", object.NewEnv(nil)).(*object.ObjError)
+	expected := "import cycle: " + dir + "/a.monkey -> " + dir + "/b.monkey -> " + dir + "/a.monkey"
+	if !ok || err.Error != expected {
+		t.Errorf("Expected error %q, got %v", expected, err)
+	}
+}
+
+func TestExceptions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`try { throw "boom" } catch (e) { e.message }`, `"boom"`},
+		{`try { throw "boom" } catch (e) { e.kind }`, `"Error"`},
+		{`try { missing } catch (e) { [e.kind, e.message] }`, `["NameError", "identifier not found: missing"]`},
+		{`try { 1 + true } catch ({kind}) { kind }`, `"TypeError"`},
+		{`try { 1 % 0 } catch (e) { [e.kind, e.message] }`, `["ArithmeticError", "division by zero"]`},
+		{`try { 1 + missing } catch (e) { e.position }`, `{"row": 1, "col": 11}`},
+		{`try { throw 42 } catch (e) { e.value }`, "42"},
+		{`try { throw {"message": "m", "kind": "Custom", "code": 7} } catch (e) { [e.kind, e.code] }`, `["Custom", 7]`},
+		{`try { try { throw "a" } catch (e) { throw e } } catch (e) { e.position.col }`, "13"},
+		{`fn f() { missing } try { f() } catch (e) { e.kind }`, `"NameError"`},
+		{`try { 1 } catch (e) { 2 }`, "1"},
+		{`try { throw "x" } catch { 2 }`, "2"},
+		{`let log = []; try { log.push(1) } finally { log.push(2) }; log`, "[1, 2]"},
+		{`let log = []; try { throw "x" } catch (e) { log.push(e.message) } finally { log.push("f") }; log`, `["x", "f"]`},
+		{`let log = []; fn f() { try { return 1 } finally { log.push("f") } } [f(), log]`, `[1, ["f"]]`},
+		{`fn f() { try { return 1 } finally { return 2 } } f()`, "2"},
+		{`fn f() { try { throw "x" } finally { return 2 } } f()`, "2"},
+		{`try { throw "x" } finally { 1 }`, "<Error: x>"},
+		{`try { throw "x" } catch (e) { throw "y" }`, "<Error: y>"},
+	}
+	for _, tt := range tests {
+		output := testEval(tt.input).String()
+		if output != tt.expected {
+			t.Errorf("%s: expected output %q, got %q", tt.input, tt.expected, output)
+		}
+	}
+}
+
+func TestDefer(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let log = []; fn f() { defer log.push(1); defer log.push(2); log.push(0) } f(); log`, "[0, 2, 1]"},
+		{`let log = []; fn f() { defer log.push("d"); return log.push("r") } [f(), log]`, `[["r", "d"], ["r", "d"]]`},
+		{`let log = []; fn f() { defer log.push("d"); missing } [try { f() } catch (e) { e.kind }, log]`, `["NameError", ["d"]]`},
+		{`let log = []; fn f() { let x = 1; defer log.push(x); x = 2; log.push(x) } f(); log`, "[2, 1]"},
+		{`let log = []; fn f() { if (true) { defer log.push("inner") } log.push("outer") } f(); log`, `["outer", "inner"]`},
+		{`let log = []; fn f() { let g = fn() { defer log.push("g") }; defer log.push("f"); g() } f(); log`, `["g", "f"]`},
+		{`fn f() { defer missing(); 1 } f()`, "<Error: identifier not found: missing>"},
+		{`fn fail() { throw "late" } fn f() { defer fail(); 1 } try { f() } catch (e) { e.message }`, `"late"`},
+		{`defer f();`, "<Error: defer outside of a function>"},
+	}
+	for _, tt := range tests {
+		output := testEval(tt.input).String()
+		if output != tt.expected {
+			t.Errorf("%s: expected output %q, got %q", tt.input, tt.expected, output)
+		}
+	}
+}
+
+func TestStructs(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"struct Point { x, y }\nPoint(1, 2)", "Point{x: 1, y: 2}"},
+		{"struct Point { x, y }\nPoint{y: 2, x: 1}", "Point{x: 1, y: 2}"},
+		{"struct Point { x, y }\nlet x = 3\nPoint{x, y: 4}", "Point{x: 3, y: 4}"},
+		{"struct Point { x, y }\nPoint(1, y: 2).y", "2"},
+		{"struct Point { x, y }\n[type(Point(1, 2)), type(1), type(Point)]", `["Point", "int", "type"]`},
+		{"struct Point { x, y }\nPoint(1, 2) == Point{x: 1, y: 2}", "true"},
+		{"struct Point { x, y }\nPoint(1, 2) == Point(2, 1)", "false"},
+		{"struct A { x }\nstruct B { x }\nA(1) == B(1)", "false"},
+		{"struct Point { x, y }\nlet {x, y} = Point(1, 2)\nx + y", "3"},
+		{"struct Point { x, y }\nmatch (Point(0, 5)) { {x: 0, y} => y, _ => -1 }", "5"},
+		{"fn origin() { Point(0, 0) }\nstruct Point { x, y }\norigin()", "Point{x: 0, y: 0}"},
+		{"struct Point { x, y }\nPoint(1)", "<Error: missing field y for Point>"},
+		{"struct Point { x, y }\nPoint(1, 2, 3)", "<Error: too many fields for Point: expected 2, got 3>"},
+		{"struct Point { x, y }\nPoint{x: 1, z: 2}", "<Error: Point has no field z>"},
+		{"struct Point { x, y }\nPoint(1, x: 2)", "<Error: field x of Point set more than once>"},
+		{"struct Point { x, y }\nPoint(1, 2).z", "<Error: Point has no field z>"},
+		{"let P = 1\nP{x: 1}", "<Error: not a struct type: int>"},
+	}
+	for _, tt := range tests {
+		output := testEval(tt.input).String()
+		if output != tt.expected {
+			t.Errorf("%s: expected output %q, got %q", tt.input, tt.expected, output)
+		}
+	}
+}
+
+func TestEnums(t *testing.T) {
+	shape := "enum Shape { Circle(r), Rect(w, h), Empty }\n"
+	area := shape + `fn area(s) {
+	match (s) {
+		Shape.Circle(r) => 3 * r * r,
+		Shape.Rect(w, h) => w * h,
+		Shape.Empty => 0,
+	}
+}
+`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{shape + "Shape.Circle(2)", "Shape.Circle{r: 2}"},
+		{shape + "Shape.Rect(h: 2, w: 3)", "Shape.Rect{w: 3, h: 2}"},
+		{shape + "Shape.Empty", "Shape.Empty"},
+		{shape + "Shape.Circle", "<variant Shape.Circle>"},
+		{shape + "[type(Shape.Circle(1)), type(Shape.Empty), type(Shape)]", `["Shape", "Shape", "enum"]`},
+		{area + "[area(Shape.Circle(2)), area(Shape.Rect(2, 3)), area(Shape.Empty)]", "[12, 6, 0]"},
+		{shape + "Shape.Empty == Shape.Empty", "true"},
+		{shape + "Shape.Circle(1) == Shape.Circle(1)", "true"},
+		{shape + "Shape.Circle(1) == Shape.Rect(1, 1)", "false"},
+		{shape + "let s = Shape.Circle(1)\n[s.is(Shape.Circle), s.is(Shape.Rect), s.is(Shape.Empty)]", "[true, false, false]"},
+		{shape + "if (Shape.Empty.is(Shape.Empty)) { 1 } else { 2 }", "1"},
+		{shape + "match (Shape.Rect(1, 2)) { Shape.Circle => 1, Shape.Rect => 2 }", "2"},
+		{shape + "let Shape.Rect(w, _) = Shape.Rect(4, 5)\nw", "4"},
+		{"struct Point { x, y }\nmatch (Point(1, 2)) { Point(x, y) => x + y }", "3"},
+		{shape + "Shape.Square", "<Error: enum Shape has no variant Square>"},
+		{shape + "match (Shape.Empty) { Shape.Square => 1 }", "<Error: enum Shape has no variant Square>"},
+		{shape + "match (Shape.Circle(1)) { Shape.Circle(a, b) => 1 }", "<Error: pattern Shape.Circle(a, b): expected 1 fields, got 2>"},
+		{shape + "match (Shape.Empty) { Shape.Circle(r) => r }", "<Error: no match arm for value: Shape.Empty>"},
+	}
+	for _, tt := range tests {
+		output := testEval(tt.input).String()
+		if output != tt.expected {
+			t.Errorf("%s: expected output %q, got %q", tt.input, tt.expected, output)
+		}
+	}
+}
+
+func TestOperatorHooks(t *testing.T) {
+	vec := `struct Vec {
+	x, y
+	fn __add__(self, o) { Vec(self.x + o.x, self.y + o.y) }
+	fn __mul__(self, k) { Vec(self.x * k, self.y * k) }
+	fn __eq__(self, o) { self.x == o.x }
+	fn __lt__(self, o) { self.norm() < o.norm() }
+	fn __str__(self) { "vec" }
+	fn __index__(self, i) { [self.x, self.y][i] }
+	fn __call__(self, k) { self.x * k }
+	fn norm(self) { self.x * self.x + self.y * self.y }
+}
+`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{vec + "Vec(1, 2) + Vec(3, 4)", "Vec{x: 4, y: 6}"},
+		{vec + "Vec(1, 2) * 3", "Vec{x: 3, y: 6}"},
+		{vec + "str([Vec(1, 2)])", `"[vec]"`},
+		{vec + "[Vec(1, 2) == Vec(1, 5), Vec(1, 2) != Vec(1, 5), [Vec(1, 2)] == [Vec(1, 0)]]", "[true, false, true]"},
+		{vec + "[Vec(1, 1) < Vec(2, 2), Vec(1, 1) > Vec(2, 2), Vec(1, 1) <= Vec(1, 1), Vec(2, 0) >= Vec(2, 2)]", "[true, false, true, false]"},
+		{vec + "Vec(7, 8)[1]", "8"},
+		{vec + "Vec(2, 0)(5)", "10"},
+		{vec + "Vec(3, 4).norm()", "25"},
+		{vec + "let n = Vec(3, 4).norm\nn()", "25"},
+		{vec + "Vec.norm(Vec(1, 1))", "2"},
+		{vec + "Vec(1, 2) - Vec(1, 2)", "<Error: Bad expression: Vec{x: 1, y: 2} - Vec{x: 1, y: 2}>"},
+		{"struct P { x }\nP(1)(2)", "<Error: not a function: P>"},
+		{"enum Light { Red, Green\nfn next(self) { match (self) { Light.Red => Light.Green, _ => Light.Red } } }\nLight.Red.next()", "Light.Green"},
+		{"struct Bad { x\nfn __eq__(self, o) { throw \"eq\" } }\n[Bad(1)] == [Bad(1)]", "<Error: eq>"},
+		{"struct Bad { x\nfn __eq__(self, o) { throw \"eq\" } }\n[Bad(1)].contains(Bad(1))", "<Error: eq>"},
+		{"struct Bad { x\nfn __str__(self) { throw \"str\" } }\nstr([Bad(1)])", "<Error: str>"},
+		{"struct Bad { x\nfn __str__(self) { throw \"str\" } }\ntry { str(Bad(1)) } catch (e) { e.message }", `"str"`},
+	}
+	for _, tt := range tests {
+		output := testEval(tt.input).String()
+		if output != tt.expected {
+			t.Errorf("%s: expected output %q, got %q", tt.input, tt.expected, output)
+		}
+	}
+
+	inspected := []struct {
+		input    string
+		expected string
+	}{
+		{"struct Money { cents\nfn __str__(self) { \"$\" } }\n[Money(5), {\"a\": Money(1)}]", `[$, {"a": $}]`},
+		{"struct P { x }\nP(\"a\")", `P{x: "a"}`},
+		{"struct Money { cents\nfn __str__(self) { \"$\" } }\nstr(Money(5))", `"$"`},
+	}
+	for _, tt := range inspected {
+		if output, err := Inspect(testEval(tt.input)); err != nil || output != tt.expected {
+			t.Errorf("%s: expected output %q, got %q", tt.input, tt.expected, output)
+		}
+	}
+
+	printed := []struct {
+		input    string
+		expected string
+	}{
+		{"struct M { c\nfn __str__(self) { \"$\" } }\n#M(5); #[M(1)]", "$[$]"},
+		{"struct P { x }\n#P(\"a\")", `P{x: "a"}`},
+	}
+	defer func(w io.Writer) { Stdout = w }(Stdout)
+	for _, tt := range printed {
+		var out bytes.Buffer
+		Stdout = &out
+		testEval(tt.input)
+		if out.String() != tt.expected {
+			t.Errorf("%s: expected to print %q, got %q", tt.input, tt.expected, out.String())
+		}
+	}
+}
+
+func TestGenerators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn gen() { yield 1; yield 2 }\nlet g = gen()\n[g.next(), g.next(), g.next()]", "[1, 2, null]"},
+		{"fn gen() { yield 1; yield 2 }\nlet out = []\nfor (x in gen()) { out.push(x) }\nout", "[1, 2]"},
+		{"fn nat() { let i = 0; for (_ in [1, 2, 3]) { ++i; yield i } }\nlet out = []\nfor (x in nat()) { out.push(x) }\nout", "[1, 2, 3]"},
+		{"fn gen() { yield 1; missing }\nlet g = gen()\n[g.next(), try { g.next() } catch (e) { e.kind }, g.next()]", `[1, "NameError", null]`},
+		{"let log = []\nfn gen() { log.push(\"start\"); yield 1 }\nlet g = gen()\nlog.push(\"made\")\ng.next()\nlog", `["made", "start"]`},
+		{"let g = (x => match (x) { _ => { yield x } })(5)\ng.next()", "5"},
+		{"fn gen() { yield g.next() }\nlet g = gen()\ng.next()", "<Error: generator already running>"},
+		{"fn gen() { yield }\ngen().next()", "null"},
+		{"fn gen() { yield 1 }\ngen()", "<generator gen>"},
+		{"let log = []\nfn gen() { defer log.push(\"closed\"); yield 1; yield 2 }\nfor (x in gen()) { log.push(x); break }\nlog.push(\"after\")\nlog", `[1, "closed", "after"]`},
+		{"let log = []\nfn gen() { defer log.push(\"closed\"); yield 1 }\nfn first() { for (x in gen()) { return x } }\n[first(), log]", `[1, ["closed"]]`},
+		{"fn gen() { defer missing(); yield 1 }\nfor (x in gen()) { break }", "<Error: identifier not found: missing>"},
+		{"let log = []\nfn gen() { defer log.push(\"closed\"); yield 1; yield 2 }\nlet g = gen()\ng.next()\ng.close()\n[log, g.next()]", `[["closed"], null]`},
+	}
+	for _, tt := range tests {
+		output := testEval(tt.input).String()
+		if output != tt.expected {
+			t.Errorf("%s: expected output %q, got %q", tt.input, tt.expected, output)
+		}
+	}
+}
+
+func TestForLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let sum = 0\nfor (x in [1, 2, 3]) { sum = sum + x }\nsum", "6"},
+		{"let out = []\nfor c in \"héj\" { out.push(c) }\nout", `["h", "é", "j"]`},
+		{"let h = {\"a\": 1, \"b\": 2}\nlet out = []\nfor (k in h) { out.push(k) }\nout", `["a", "b"]`},
+		{"let out = []\nfor ([a, b] in [[1, 2], [3, 4]]) { out.push(a + b) }\nout", "[3, 7]"},
+		{"let out = []\nfor (x in [1, 2, 3, 4]) { if (x == 2) { continue } if (x == 4) { break } out.push(x) }\nout", "[1, 3]"},
+		{"fn find(xs) { for (x in xs) { if (x > 1) { return x } } -1 }\n[find([1, 5, 7]), find([])]", "[5, -1]"},
+		{"let fs = []\nfor (x in [1, 2]) { fs.push(() => x) }\n[fs[0](), fs[1]()]", "[1, 2]"},
+		{"let out = []\nfor (x in [1, 2, 3]) { try { if (x == 2) { break } } finally { out.push(x) } }\nout", "[1, 2]"},
+		{"struct Bag { items\nfn __iter__(self) { self.items } }\nlet n = 0\nfor (x in Bag([1, 2])) { n = n + x }\nn", "3"},
+		{"for (x in 5) { x }", "<Error: not iterable: int>"},
+		{"for (x in [1]) { missing }", "<Error: identifier not found: missing>"},
+	}
+	for _, tt := range tests {
+		output := testEval(tt.input).String()
+		if output != tt.expected {
+			t.Errorf("%s: expected output %q, got %q", tt.input, tt.expected, output)
+		}
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let c = chan()\nspawn (fn() { for (x in [1, 2, 3]) { c.send(x) } c.close() })()\nlet out = []\nfor (x in [1, 2, 3, 4]) { out.push(c.recv()) }\nout", "[1, 2, 3, null]"},
+		{"let t = spawn (fn(a, b) { a * b })(6, 7)\nt.wait()", "42"},
+		{"let c = chan(2)\nc.send(1)\nc.send(2)\n[c.len(), c.recv(), c.recv()]", "[2, 1, 2]"},
+		{"let c = chan(1)\nselect { c.recv() as v => v, _ => \"empty\" }", `"empty"`},
+		{"let c = chan(1)\nlet d = chan(1)\nd.send(4)\nselect { c.recv() as v => v, d.recv() as v => v * 2 }", "8"},
+		{"let c = chan(1)\nselect { c.send(1) => \"sent\", _ => \"full\" }", `"sent"`},
+		{"let c = chan()\nlet done = chan()\nspawn (fn() { done.send(c.recv() + 1) })()\nc.send(1)\ndone.recv()", "2"},
+		{"let c = chan()\nc.recv()", "<Error: deadlock: all tasks are blocked>"},
+		{"let c = chan()\nlet t = spawn (fn() { c.recv() })()\ntry { t.wait() } catch (e) { e.kind }", `"DeadlockError"`},
+		{"let c = chan()\nc.close()\nc.send(1)", "<Error: send on closed channel>"},
+		{"let c = chan()\nc.close()\nc.close()", "<Error: close of closed channel>"},
+		{"spawn (fn() { missing })().wait()", "<Error: identifier not found: missing>"},
+		{"chan(-1)", "<Error: chan: capacity must be a non-negative int, got -1>"},
+	}
+	for _, tt := range tests {
+		output := testEval(tt.input).String()
+		if output != tt.expected {
+			t.Errorf("%s: expected output %q, got %q", tt.input, tt.expected, output)
+		}
+	}
+}
+
+func TestQuoteUnquote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"quote(5 + 8)", "quote((5+8))"},
+		{"quote(foo)", "quote(foo)"},
+		{"quote(unquote(4 + 4) + 8)", "quote((8+8))"},
+		{"let q = quote(4 + 4)\nquote(unquote(q) * 2)", "quote(((4+4)*2))"},
+		{"quote(unquote(1 > 2))", "quote(false)"},
+		{"quote(unquote([1, \"a\"]))", `quote([1, "a"])`},
+		{"quote(unquote(missing))", "<Error: identifier not found: missing>"},
+		{"quote(unquote(fn() {}))", "<Error: cannot unquote function>"},
+	}
+	for _, tt := range tests {
+		output := testEval(tt.input).String()
+		if output != tt.expected {
+			t.Errorf("%s: expected output %q, got %q", tt.input, tt.expected, output)
+		}
+	}
+}
+
+func TestMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let unless = macro(cond, cons, alt) { quote(if (!(unquote(cond))) { unquote(cons) } else { unquote(alt) }) };\nunless(10 > 5, \"no\", \"yes\")", `"yes"`},
+		{"let twice = macro(e) { quote(unquote(e) + unquote(e)) };\nlet n = 0\ntwice(++n)", "3"},
+		{"let reverse = macro(a, b) { quote(unquote(b) - unquote(a)) };\nreverse(2 + 2, 10 - 5)", "1"},
+		{"let addOne = macro(e) { quote((fn() { let tmp = 1; unquote(e) + tmp })()) };\nlet tmp = 10\n[addOne(tmp), addOne(addOne(tmp))]", "[11, 12]"},
+		{"let m = macro(x) { quote(unquote(x)) };\nfn f() { m(2) }\nf()", "2"},
+		{"let m = macro(x) { quote([tmp + unquote(x) for tmp in [1]]) };\nlet tmp = 10\nm(tmp)", "[11]"},
+		{"let m = macro(h) { quote({k: v for k, v in unquote(h)}) };\nlet k = \"a\"\nlet v = 1\nlet r = m({k: v})\nr", `{"a": 1}`},
+		{"let m = macro(x) { 1 };\nm(2)", "<Error: macro m returned int, expected quote>"},
+		{"let m = macro(x) { quote(unquote(x)) };\nm(1, 2)", "<Error: wrong number of arguments to macro m: expected 1, got 2>"},
+		{"let m = fn() { macro(x) { x } }\nm()", "<Error: macros can only be defined by a top-level let>"},
+	}
+	for _, tt := range tests {
+		ch := make(chan *token.Token)
+		program := parser.New(lexer.New(tt.input, ch), ch).Parse()
+		macros := object.NewEnv(nil)
+		DefineMacros(program, macros)
+		var output string
+		if expanded, err := ExpandMacros(program, macros); err != nil {
+			output = err.String()
+		} else {
+			output = Eval(expanded, object.NewEnv(nil)).String()
+		}
+		if output != tt.expected {
+			t.Errorf("%s: expected output %q, got %q", tt.input, tt.expected, output)
+		}
+	}
+}
+
+func TestDocComments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"/// Adds two numbers.\nfn add(a, b) { a + b }\ndoc(add)", `"Adds two numbers."`},
+		{"/// Doubles.\nlet double = fn(x) { x * 2 }\ndoc(double)", `"Doubles."`},
+		{"/// One.\n/// Two.\nfn f() {}\ndoc(f)", "\"One.\nTwo.\""},
+		{"struct P { x\n/// The x.\nfn getX(self) { self.x } }\ndoc(P(1).getX)", `"The x."`},
+		{"// Not a doc comment.\nfn f() {}\ndoc(f)", "null"},
+		{"/// A function.\nlet f = fn() {}\nlet g = f\ndoc(g)", `"A function."`},
+		{"doc(1)", "null"},
+	}
+	for _, tt := range tests {
+		output := testEval(tt.input).String()
+		if output != tt.expected {
+			t.Errorf("%s: expected output %q, got %q", tt.input, tt.expected, output)
+		}
+	}
+}
+
+func TestTypeAnnotationsIgnored(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x: string = 1;\nx", "1"},
+		{"fn f(a: int, b: int) -> int { a - b }\nf(b: 1, a: 3)", "2"},
+		{"let f: fn(int) -> int = fn(n: int) { n }\n[f(1), f(\"a\")]", `[1, "a"]`},
+	}
+	for _, tt := range tests {
+		output := testEval(tt.input).String()
+		if output != tt.expected {
+			t.Errorf("%s: expected output %q, got %q", tt.input, tt.expected, output)
+		}
+	}
+}
+
+func TestNull(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"null", "null"},
+		{"if (null) { 1 } else { 2 }", "2"},
+		{"[null ?? 1, 0 ?? 1, false ?? 1]", "[1, 0, false]"},
+		{"let n = 0\nlet x = 1 ?? ++n\n[x, n]", "[1, 0]"},
+		{"let cfg = {\"db\": {\"port\": 5432}}\n[cfg[\"db\"]?.[\"port\"], cfg[\"web\"]?.[\"port\"] ?? 80]", "[5432, 80]"},
+		{"let cfg = null\ncfg?.db.port", "null"},
+		{"struct P { x }\nlet p = P(1)\n[p?.x, null?.x]", "[1, null]"},
+		{"let f = null\nf?.(1)", "null"},
+		{"let f = fn(x) { x + 1 }\nf?.(1)", "2"},
+		{"let n = 0\nnull?.[++n]\nn", "0"},
+		{"let cfg = null\ncfg.db?.port", "<Error: unknown member db for null>"},
+		{"let cfg = {\"a\": 1}\n[cfg?.db?.host, cfg.db?.host, cfg.db ?? \"none\", cfg.a]", `[null, null, "none", 1]`},
+		{"let cfg = {\"db\": {\"host\": \"h\"}}\n[cfg.db?.host, cfg.db.port ?? 5432, cfg.web?.tls?.cert]", `["h", 5432, null]`},
+		{"let cfg = {\"a\": 1}\ncfg.db.host", "<Error: unknown member host for null>"},
+		{"let h = {\"a\": 1}\n[h.keys(), h.len]", `[["a"], <builtin hash.len>]`},
+		{"match null { null => \"none\", _ => \"some\" }", `"none"`},
+	}
+	for _, tt := range tests {
+		output := testEval(tt.input).String()
+		if output != tt.expected {
+			t.Errorf("%s: expected output %q, got %q", tt.input, tt.expected, output)
+		}
+	}
+}
+
+func TestSlices(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2, 3, 4, 5][1:4]", "[2, 3, 4]"},
+		{"[1, 2, 3, 4, 5][:-1]", "[1, 2, 3, 4]"},
+		{"[1, 2, 3, 4, 5][-2:]", "[4, 5]"},
+		{"[1, 2, 3, 4, 5][::2]", "[1, 3, 5]"},
+		{"[1, 2, 3, 4, 5][::-1]", "[5, 4, 3, 2, 1]"},
+		{"[1, 2, 3, 4, 5][3:0:-1]", "[4, 3, 2]"},
+		{"[1, 2, 3, 4, 5][-10:10]", "[1, 2, 3, 4, 5]"},
+		{"[1, 2, 3][2:1]", "[]"},
+		{"[1, 2, 3][null:2]", "[1, 2]"},
+		{"let xs = [1, 2, 3]\nlet ys = xs[:]\nys.push(4)\nxs", "[1, 2, 3]"},
+		{`"hello"[1:4]`, `"ell"`},
+		{`"héllo wörld"[-5:]`, `"wörld"`},
+		{`"日本語"[::-1]`, `"語本日"`},
+		{"null?.[1:]", "null"},
+		{"[1, 2][::0]", "<Error: slice step cannot be zero>"},
+		{`[1, 2]["a":]`, "<Error: slice index must be int, got string>"},
+		{"5[1:]", "<Error: slice operator not supported: int>"},
+	}
+	for _, tt := range tests {
+		output := testEval(tt.input).String()
+		if output != tt.expected {
+			t.Errorf("%s: expected output %q, got %q", tt.input, tt.expected, output)
+		}
+	}
+}
+
+func TestComprehensions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[x * x for x in [1, 2, 3, 4] if x % 2 == 0]", "[4, 16]"},
+		{"[x for x in []]", "[]"},
+		{`[c.upper() for c in "abc"]`, `["A", "B", "C"]`},
+		{`let h = {"a": 1, "b": 2}` + "\n" + `let r = {k: v * 10 for k, v in h}` + "\nr", `{"a": 10, "b": 20}`},
+		{`let r = {v: k for k, v in ["x", "y"]}` + "\nr", `{"x": 0, "y": 1}`},
+		{"[i for i, c in \"héllo\" if c == \"l\"]", "[2, 3]"},
+		{"[a + b for [a, b] in [[1, 2], [3, 4]]]", "[3, 7]"},
+		{"let x = 10\nlet ys = [x for x in [1, 2]]\n[x, ys]", "[10, [1, 2]]"},
+		{"let fs = [fn() { i } for i in [1, 2]]\n[fs[0](), fs[1]()]", "[1, 2]"},
+		{"fn count() { yield 1\nyield 2 }\n[n * 2 for n in count()]", "[2, 4]"},
+		{"[x for x in 5]", "<Error: not iterable: int>"},
+		{"[x for x, y in 5]", "<Error: cannot iterate over int with two variables>"},
+		{"let r = {[x]: x for x in [1]}\nr", "<Error: unusable as hash key: array>"},
+	}
+	for _, tt := range tests {
+		output := testEval(tt.input).String()
+		if output != tt.expected {
+			t.Errorf("%s: expected output %q, got %q", tt.input, tt.expected, output)
+		}
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	defer func(max int) { MaxDepth = max }(MaxDepth)
+	MaxDepth = 100
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn count(n) { if (n == 0) { return \"done\" } return count(n - 1) }\ncount(100000)", `"done"`},
+		{"fn even(n) { if (n == 0) { return true } return odd(n - 1) }\nfn odd(n) { if (n == 0) { return false } return even(n - 1) }\neven(1001)", "false"},
+		{"struct C { n\nfn down(self, i) { if (i == 0) { return self.n } return self.down(i - 1) } }\nC(7).down(1000)", "7"},
+		{"let sum = fn(n, acc) { if (n == 0) { return acc } return sum(n - 1, acc + n) }\nsum(1000, 0)", "500500"},
+		{"fn f(n) { if (n == 0) { return 0 } return 1 + f(n - 1) }\nf(50)", "50"},
+		{"fn f(n) { if (n == 0) { return 0 } return 1 + f(n - 1) }\nf(1000)", "<Error: maximum recursion depth exceeded>"},
+		{"fn f() { 1 + f() }\ntry { f() } catch (e) { e.kind }", `"RecursionError"`},
+		{"fn g() { try { return h() } catch (e) { return \"caught\" } }\nfn h() { throw \"oops\" }\ng()", `"caught"`},
+		{"let log = []\nfn after() { log.push(\"after\") }\nfn f() { defer log.push(\"deferred\")\nreturn after() }\nf()\nlog", `["after", "deferred"]`},
+		{"fn f() { return g(1, 2) }\nfn g(a) { a }\nf()", "<Error: too many arguments: expected 1, got 2>"},
+		{"fn q() { return quote(1 + 2) }\nq()", "quote((1+2))"},
+		{"let f = null\nfn t() { return f?.() }\nt()", "null"},
+		{"null?.().x", "null"},
+		{"let loop = fn(n) { if (n == 0) { return \"done\" } loop(n - 1) }\nloop(20000)", `"done"`},
+		{"fn loop(n) { if (n == 0) { \"done\" } else { loop(n - 1) } }\nloop(20000)", `"done"`},
+		{"let down = (n, acc) => match n { 0 => acc, _ => down(n - 1, acc + 1) }\ndown(20000, 0)", "20000"},
+		{"fn f(n) { if (n == 0) { return 0 } f(n - 1);\n}\nf(1000)", "<Error: maximum recursion depth exceeded>"},
+		{"let log = []\nfn f(n) { defer log.push(n)\nif (n > 0) { f(n - 1) } }\nf(3)\nlog", "[0, 1, 2, 3]"},
+	}
+	for _, tt := range tests {
+		output := testEval(tt.input).String()
+		if output != tt.expected {
+			t.Errorf("%s: expected output %q, got %q", tt.input, tt.expected, output)
+		}
+	}
+
+	input := "fn f(n) { if (n == 0) { return missing } return f(n - 1) }\nfn g() { 1 + f(3) }\ng()"
+	err, ok := testEval(input).(*object.ObjError)
+	if !ok {
+		t.Fatalf("Expected error, got %T", err)
+	}
+	expected := "<Error: identifier not found: missing>\n    in f (4 times)\n    in g"
+	if trace := err.Trace(); trace != expected {
+		t.Errorf("Expected trace %q, got %q", expected, trace)
+	}
+}
+
+func TestRegex(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`re"\d+"`, `re"\d+"`},
+		{`type(re"a")`, `"regex"`},
+		{`re"(\w+)=(\d+)?".match("x key= y")`, `["key=", "key", null]`},
+		{`re"^\d+$".match("12a")`, "null"},
+		{`re"(?i)error".match("An ERROR occurred")`, `["ERROR"]`},
+		{`re"\d+".find_all("a1 b22 c333")`, `["1", "22", "333"]`},
+		{`re"(\w)(\d)".find_all("a1 b2")`, `[["a1", "a", "1"], ["b2", "b", "2"]]`},
+		{`re"x".find_all("abc")`, "[]"},
+		{`re"(\w+)@(\w+)".replace("bob@host, amy@box", "$2:$1")`, `"host:bob, box:amy"`},
+		{`re"(?P<n>\d+)".replace("a1b2", "<${n}>")`, `"a<1>b<2>"`},
+		{"re\"\\d+\".replace(\"a1b22\", fn(m) { str(m[0].len()) })", `"a1b2"`},
+		{`re"\s*,\s*".split("a , b,c")`, `["a", "b", "c"]`},
+		{`re"\d".match(1)`, "<Error: match: expected string, got int>"},
+		{`re"\d".replace("1", fn(m) { 1 })`, "<Error: replace: expected the replacement to be string, got int>"},
+		{"let r = re\"(\\d+)\"\nlet q = quote(unquote(r).match(\"42\"))\nq", `quote(re"(\d+)".match("42"))`},
+	}
+	for _, tt := range tests {
+		output := testEval(tt.input).String()
+		if output != tt.expected {
+			t.Errorf("%s: expected output %q, got %q", tt.input, tt.expected, output)
+		}
+	}
+}
+
+func testEval(input string) object.Object {
+	ch := make(chan *token.Token)
+	l := lexer.New(input, ch)
+	program := parser.New(l, ch).Parse()
+	return Eval(program, object.NewEnv(nil))
+}
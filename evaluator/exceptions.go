@@ -0,0 +1,93 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+	"monkey/token"
+)
+
+func evalTryExpr(n *ast.TryExpr, env object.Env) object.Object {
+	if env.Frame != nil {
+		env.Frame.Tries++
+		defer func() { env.Frame.Tries-- }()
+	}
+	ret := Eval(n.Body, env)
+	if err, ok := ret.(*object.ObjError); ok && n.Catch != nil {
+		catchenv := object.NewEnv(&env)
+		ret = nil
+		if n.Param != nil {
+			if bindErr := bindPattern(n.Param, caught(err), catchenv, false); bindErr != nil {
+				ret = at(n.Token, bindErr)
+			}
+		}
+		if ret == nil {
+			ret = Eval(n.Catch, catchenv)
+		}
+	}
+	if n.Finally != nil {
+		// An abrupt completion of the finally block replaces the pending result.
+		switch fin := Eval(n.Finally, env); fin.(type) {
+		case *object.ObjReturn, *object.ObjError, *object.ObjBreak, *object.ObjContinue:
+			return fin
+		}
+	}
+	return ret
+}
+
+func throw(val object.Object) *object.ObjError {
+	err := &object.ObjError{Error: val.String(), Kind: object.Error, Value: val}
+	if str, ok := val.(*object.ObjString); ok {
+		err.Error = str.Value
+	}
+	if hash, ok := val.(*object.ObjHash); ok {
+		if msg, ok := hash.Get(&object.ObjString{Value: "message"}); ok {
+			err.Error = msg.String()
+			if str, ok := msg.(*object.ObjString); ok {
+				err.Error = str.Value
+			}
+		}
+		if kind, ok := hash.Get(&object.ObjString{Value: "kind"}); ok {
+			if str, ok := kind.(*object.ObjString); ok {
+				err.Kind = str.Value
+			}
+		}
+	}
+	return err
+}
+
+// caught converts an error into the value bound by a catch clause. Thrown
+// hashes keep their own fields; anything else thrown is kept under "value".
+func caught(err *object.ObjError) object.Object {
+	hash := object.NewHash()
+	thrown, isHash := err.Value.(*object.ObjHash)
+	if isHash {
+		for _, key := range thrown.Keys {
+			pair := thrown.Pairs[key]
+			hash.Set(pair.Key.(object.Hashable), pair.Value)
+		}
+	}
+	hash.Set(&object.ObjString{Value: "message"}, &object.ObjString{Value: err.Error})
+	hash.Set(&object.ObjString{Value: "kind"}, &object.ObjString{Value: err.Kind})
+	if _, ok := hash.Get(&object.ObjString{Value: "position"}); !ok {
+		var pos object.Object = nullObj
+		if err.Pos != nil {
+			pos = object.NewHash()
+			pos.(*object.ObjHash).Set(&object.ObjString{Value: "row"}, &object.ObjInt{Value: int64(err.Pos.Row)})
+			pos.(*object.ObjHash).Set(&object.ObjString{Value: "col"}, &object.ObjInt{Value: int64(err.Pos.Col)})
+		}
+		hash.Set(&object.ObjString{Value: "position"}, pos)
+	}
+	if err.Value != nil && !isHash {
+		hash.Set(&object.ObjString{Value: "value"}, err.Value)
+	}
+	return hash
+}
+
+// at records tok as the position of o if it is an error that has none yet, so
+// that the innermost position wins.
+func at(tok *token.Token, o object.Object) object.Object {
+	if err, ok := o.(*object.ObjError); ok && err.Pos == nil {
+		err.Pos = tok
+	}
+	return o
+}
@@ -0,0 +1,152 @@
+package evaluator
+
+import "monkey/object"
+
+// newGenerator runs the body of fn as a coroutine on its own goroutine. Control
+// passes back and forth over unbuffered channels, so only one side runs at a
+// time and the evaluator needs no locking.
+func newGenerator(fn *object.ObjFunc, env object.Env) *object.ObjGenerator {
+	results := make(chan object.Object)
+	resume := make(chan struct{})
+	stop := make(chan struct{})
+	exit := func() *object.ObjError {
+		return errorf(object.GeneratorExit, "generator closed")
+	}
+
+	env.Frame.Yield = func(val object.Object) *object.ObjError {
+		select {
+		case results <- val:
+		case <-stop:
+			return exit()
+		}
+		select {
+		case <-resume:
+			return nil
+		case <-stop:
+			return exit()
+		}
+	}
+
+	started, running, done := false, false, false
+	gen := &object.ObjGenerator{Name: fn.Name}
+	gen.Next = func() (object.Object, bool) {
+		if done {
+			return nil, false
+		}
+		if running {
+			return errorf(object.Error, "generator already running"), true
+		}
+		running = true
+		if started {
+			resume <- struct{}{}
+		} else {
+			started = true
+			go func() {
+				if ret := runBody(fn, env); isError(ret) {
+					select {
+					case results <- ret:
+					case <-stop:
+					}
+				}
+				close(results)
+			}()
+		}
+		val, ok := <-results
+		running = false
+		if !ok || isError(val) {
+			done = true
+		}
+		return val, ok
+	}
+	gen.Close = func() *object.ObjError {
+		if done || running {
+			return nil
+		}
+		done = true
+		if !started {
+			return nil
+		}
+		// The suspended yield fails with GeneratorExit, unwinding the body
+		// while this task waits, as it would for Next.
+		close(stop)
+		var err *object.ObjError
+		for ret := range results {
+			if e, ok := ret.(*object.ObjError); ok && e.Kind != object.GeneratorExit {
+				err = e
+			}
+		}
+		return err
+	}
+	return gen
+}
+
+// iterate calls each with the successive elements of obj until it completes
+// abruptly with anything but continue. A generator left unfinished is closed.
+func iterate(obj object.Object, each func(object.Object) object.Object) object.Object {
+	next, gen, err := iterator(obj)
+	if err != nil {
+		return err
+	}
+	for {
+		val, ok := next()
+		if !ok {
+			return nullObj
+		}
+		if isError(val) {
+			return val
+		}
+		ret := each(val)
+		switch ret.(type) {
+		case *object.ObjBreak, *object.ObjReturn, *object.ObjError:
+		default:
+			continue
+		}
+		if gen != nil {
+			if err := gen.Close(); err != nil && !isError(ret) {
+				return err
+			}
+		}
+		if _, ok := ret.(*object.ObjBreak); ok {
+			return nullObj
+		}
+		return ret
+	}
+}
+
+// iterator returns a function yielding the elements of obj, and the generator
+// producing them, if any.
+func iterator(obj object.Object) (func() (object.Object, bool), *object.ObjGenerator, object.Object) {
+	var elems []object.Object
+	switch obj := obj.(type) {
+	case *object.ObjGenerator:
+		return obj.Next, obj, nil
+	case *object.ObjArray:
+		elems = obj.Elems
+	case *object.ObjString:
+		for _, r := range obj.Value {
+			elems = append(elems, &object.ObjString{Value: string(r)})
+		}
+	case *object.ObjHash:
+		for _, key := range obj.Keys {
+			elems = append(elems, obj.Pairs[key].Key)
+		}
+	case *object.ObjStruct:
+		if iter, ok := callHook(obj, "__iter__"); ok {
+			if isError(iter) {
+				return nil, nil, iter
+			}
+			return iterator(iter)
+		}
+		return nil, nil, errorf(object.TypeError, "not iterable: %s", obj.TypeName())
+	default:
+		return nil, nil, errorf(object.TypeError, "not iterable: %s", obj.Type())
+	}
+	i := 0
+	return func() (object.Object, bool) {
+		if i >= len(elems) {
+			return nil, false
+		}
+		i++
+		return elems[i-1], true
+	}, nil, nil
+}
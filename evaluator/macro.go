@@ -0,0 +1,227 @@
+package evaluator
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/object"
+	"monkey/token"
+	"strconv"
+)
+
+var (
+	// Set while a macro body runs, so that quote renames the names it binds.
+	expanding int
+	gensyms   int
+)
+
+// DefineMacros removes the top-level `let name = macro(...) { ... }`
+// statements from prog, declaring the macros in env.
+func DefineMacros(prog *ast.Program, env object.Env) {
+	stmts := prog.Stmts[:0]
+	for _, stmt := range prog.Stmts {
+		if let, ok := stmt.(*ast.LetStmt); ok {
+			name, isIdent := let.Name.(*ast.IdentExpr)
+			if macro, ok := let.Value.(*ast.MacroExpr); ok && isIdent {
+				env.Declare(name.Value, &object.ObjMacro{Args: macro.Args, Body: macro.Body, Env: &env}, true, name.Token)
+				continue
+			}
+		}
+		stmts = append(stmts, stmt)
+	}
+	prog.Stmts = stmts
+}
+
+// ExpandMacros returns a copy of prog in which every call of a macro defined
+// in env is replaced by the code it returns.
+func ExpandMacros(prog *ast.Program, env object.Env) (*ast.Program, *object.ObjError) {
+	var err *object.ObjError
+	expanded := ast.Modify(prog, func(node ast.Node) ast.Node {
+		call, ok := node.(*ast.FuncCallExpr)
+		if !ok || err != nil {
+			return node
+		}
+		name, ok := call.Func.(*ast.IdentExpr)
+		if !ok {
+			return node
+		}
+		obj, _ := env.Get(name.Value)
+		macro, ok := obj.(*object.ObjMacro)
+		if !ok {
+			return node
+		}
+		if len(call.Args) != len(macro.Args) || len(call.KwArgs) > 0 {
+			err = errorf(object.ArgumentError, "wrong number of arguments to macro %s: expected %d, got %d", name.Value, len(macro.Args), len(call.Args)+len(call.KwArgs))
+			err.Pos = call.Token
+			return node
+		}
+		macroenv := object.NewEnv(macro.Env)
+		macroenv.Frame = &object.Frame{}
+		for i, arg := range macro.Args {
+			macroenv.Declare(arg.Value, &object.ObjQuote{Node: call.Args[i]}, false, arg.Token)
+		}
+		expanding++
+		ret := Eval(macro.Body, macroenv)
+		expanding--
+		if r, ok := ret.(*object.ObjReturn); ok {
+			ret = r.Value
+		}
+		switch ret := ret.(type) {
+		case *object.ObjError:
+			err = at(call.Token, ret).(*object.ObjError)
+			err.Stack = append(err.Stack, "macro "+name.Value)
+		case *object.ObjQuote:
+			if expr, ok := ret.Node.(ast.Expr); ok {
+				return expr
+			}
+		default:
+			err = errorf(object.TypeError, "macro %s returned %s, expected quote", name.Value, ret.Type())
+			err.Pos = call.Token
+		}
+		return node
+	})
+	if err != nil {
+		return nil, err
+	}
+	return expanded.(*ast.Program), nil
+}
+
+func isUnquote(node ast.Node) (*ast.FuncCallExpr, bool) {
+	call, ok := node.(*ast.FuncCallExpr)
+	if !ok || len(call.Args) != 1 {
+		return nil, false
+	}
+	name, ok := call.Func.(*ast.IdentExpr)
+	return call, ok && name.Value == "unquote"
+}
+
+func isQuote(call *ast.FuncCallExpr) bool {
+	name, ok := call.Func.(*ast.IdentExpr)
+	return ok && name.Value == "quote" && len(call.Args) == 1
+}
+
+// quote evaluates the unquote calls in node. Inside a macro, the names bound
+// by the quoted code are renamed first, so they can neither capture nor
+// shadow the names in the code spliced in, or at the call site.
+func quote(node ast.Node, env object.Env) object.Object {
+	var err object.Object
+	spliced := make(map[string]ast.Node)
+	node = ast.Modify(node, func(node ast.Node) ast.Node {
+		call, ok := isUnquote(node)
+		if !ok || err != nil {
+			return node
+		}
+		val := Eval(call.Args[0], env)
+		if isError(val) {
+			err = val
+			return node
+		}
+		splice, convErr := objectToNode(val, call.Token)
+		if convErr != nil {
+			err = at(call.Token, convErr)
+			return node
+		}
+		if expanding == 0 {
+			return splice
+		}
+		placeholder := fmt.Sprintf("unquote#%d", len(spliced))
+		spliced[placeholder] = splice
+		return &ast.IdentExpr{Token: call.Token, Value: placeholder}
+	})
+	if err != nil {
+		return err
+	}
+	if expanding > 0 {
+		node = hygienic(node, spliced)
+	}
+	return &object.ObjQuote{Node: node}
+}
+
+func hygienic(node ast.Node, spliced map[string]ast.Node) ast.Node {
+	renamed := make(map[string]string)
+	bind := func(patterns ...ast.Pattern) {
+		for _, pattern := range patterns {
+			for _, name := range ast.PatternNames(pattern) {
+				if _, ok := renamed[name]; !ok {
+					gensyms++
+					renamed[name] = name + "#" + strconv.Itoa(gensyms)
+				}
+			}
+		}
+	}
+	ast.Modify(node, func(node ast.Node) ast.Node {
+		switch n := node.(type) {
+		case *ast.LetStmt:
+			bind(n.Name)
+		case *ast.FuncStmt:
+			bind(n.Name)
+		case *ast.FuncExpr:
+			bind(n.Args...)
+		case *ast.ForStmt:
+			bind(n.Var)
+		case *ast.ComprehensionExpr:
+			bind(n.Vars...)
+		case *ast.TryExpr:
+			bind(n.Param)
+		case *ast.MatchExpr:
+			for _, arm := range n.Arms {
+				bind(arm.Pattern)
+			}
+		case *ast.SelectExpr:
+			for _, c := range n.Cases {
+				bind(c.Binding)
+			}
+		}
+		return node
+	})
+	return ast.Modify(node, func(node ast.Node) ast.Node {
+		ident, ok := node.(*ast.IdentExpr)
+		if !ok {
+			return node
+		}
+		if splice, ok := spliced[ident.Value]; ok {
+			return splice
+		}
+		if name, ok := renamed[ident.Value]; ok {
+			return &ast.IdentExpr{Token: ident.Token, Value: name}
+		}
+		return node
+	})
+}
+
+func objectToNode(obj object.Object, tok *token.Token) (ast.Node, *object.ObjError) {
+	lit := func(typ token.TokenType, literal string) *token.Token {
+		return &token.Token{Type: typ, Literal: literal, Row: tok.Row, Col: tok.Col}
+	}
+	switch obj := obj.(type) {
+	case *object.ObjQuote:
+		return obj.Node, nil
+	case *object.ObjInt:
+		return &ast.IntLiteralExpr{Token: lit(token.Int, obj.String()), Value: obj.Value}, nil
+	case *object.ObjBool:
+		typ := token.False
+		if obj.Value {
+			typ = token.True
+		}
+		return &ast.BoolExpr{Token: lit(typ, obj.String()), Value: obj.Value}, nil
+	case *object.ObjString:
+		return &ast.StringExpr{Token: lit(token.DQuote, obj.Value), Value: obj.Value}, nil
+	case *object.ObjNull:
+		return &ast.NullExpr{Token: lit(token.Null, "null")}, nil
+	case *object.ObjRegex:
+		return &ast.RegexExpr{Token: lit(token.Regex, "re"), Regexp: obj.Value}, nil
+	case *object.ObjArray:
+		elems := make([]ast.Expr, len(obj.Elems))
+		for i, elem := range obj.Elems {
+			node, err := objectToNode(elem, tok)
+			if err != nil {
+				return nil, err
+			}
+			if elems[i], _ = node.(ast.Expr); elems[i] == nil {
+				return nil, errorf(object.TypeError, "cannot unquote %s in an array", node)
+			}
+		}
+		return &ast.ArrayExpr{Token: lit(token.LBracket, "["), Elems: elems}, nil
+	default:
+		return nil, errorf(object.TypeError, "cannot unquote %s", obj.Type())
+	}
+}
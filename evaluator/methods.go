@@ -0,0 +1,326 @@
+package evaluator
+
+import (
+	"monkey/object"
+	"strings"
+)
+
+type method struct {
+	arity int
+	fn    func(self object.Object, args []object.Object) object.Object
+}
+
+var methods map[object.ObjectType]map[string]method
+
+// Assigned in init since equality can call user methods, which evaluate code
+// that refers back to methods.
+func init() {
+	methods = map[object.ObjectType]map[string]method{
+		object.ObjTypeString: {
+			"len": {0, func(self object.Object, args []object.Object) object.Object {
+				return &object.ObjInt{Value: int64(len([]rune(self.(*object.ObjString).Value)))}
+			}},
+			"upper": {0, func(self object.Object, args []object.Object) object.Object {
+				return &object.ObjString{Value: strings.ToUpper(self.(*object.ObjString).Value)}
+			}},
+			"lower": {0, func(self object.Object, args []object.Object) object.Object {
+				return &object.ObjString{Value: strings.ToLower(self.(*object.ObjString).Value)}
+			}},
+			"trim": {0, func(self object.Object, args []object.Object) object.Object {
+				return &object.ObjString{Value: strings.TrimSpace(self.(*object.ObjString).Value)}
+			}},
+			"contains": {1, func(self object.Object, args []object.Object) object.Object {
+				sub, ok := args[0].(*object.ObjString)
+				if !ok {
+					return errorf(object.TypeError, "contains: expected string, got %s", args[0].Type())
+				}
+				return getBool(strings.Contains(self.(*object.ObjString).Value, sub.Value))
+			}},
+			"split": {1, func(self object.Object, args []object.Object) object.Object {
+				sep, ok := args[0].(*object.ObjString)
+				if !ok {
+					return errorf(object.TypeError, "split: expected string, got %s", args[0].Type())
+				}
+				parts := strings.Split(self.(*object.ObjString).Value, sep.Value)
+				elems := make([]object.Object, len(parts))
+				for i, part := range parts {
+					elems[i] = &object.ObjString{Value: part}
+				}
+				return &object.ObjArray{Elems: elems}
+			}},
+		},
+		object.ObjTypeArray: {
+			"len": {0, func(self object.Object, args []object.Object) object.Object {
+				return &object.ObjInt{Value: int64(len(self.(*object.ObjArray).Elems))}
+			}},
+			"push": {1, func(self object.Object, args []object.Object) object.Object {
+				arr := self.(*object.ObjArray)
+				arr.Elems = append(arr.Elems, args[0])
+				return arr
+			}},
+			"pop": {0, func(self object.Object, args []object.Object) object.Object {
+				arr := self.(*object.ObjArray)
+				if len(arr.Elems) == 0 {
+					return nullObj
+				}
+				last := arr.Elems[len(arr.Elems)-1]
+				arr.Elems = arr.Elems[:len(arr.Elems)-1]
+				return last
+			}},
+			"first": {0, func(self object.Object, args []object.Object) object.Object {
+				return evalIndexExpr(self, &object.ObjInt{Value: 0})
+			}},
+			"last": {0, func(self object.Object, args []object.Object) object.Object {
+				arr := self.(*object.ObjArray)
+				return evalIndexExpr(arr, &object.ObjInt{Value: int64(len(arr.Elems) - 1)})
+			}},
+			"contains": {1, func(self object.Object, args []object.Object) object.Object {
+				for _, elem := range self.(*object.ObjArray).Elems {
+					if eq, err := objectsEqual(elem, args[0]); err != nil {
+						return err
+					} else if eq {
+						return trueObj
+					}
+				}
+				return falseObj
+			}},
+			"join": {1, func(self object.Object, args []object.Object) object.Object {
+				sep, ok := args[0].(*object.ObjString)
+				if !ok {
+					return errorf(object.TypeError, "join: expected string, got %s", args[0].Type())
+				}
+				elems := self.(*object.ObjArray).Elems
+				parts := make([]string, len(elems))
+				for i, elem := range elems {
+					if str, ok := elem.(*object.ObjString); ok {
+						parts[i] = str.Value
+					} else {
+						parts[i] = elem.String()
+					}
+				}
+				return &object.ObjString{Value: strings.Join(parts, sep.Value)}
+			}},
+		},
+		object.ObjTypeHash: {
+			"len": {0, func(self object.Object, args []object.Object) object.Object {
+				return &object.ObjInt{Value: int64(len(self.(*object.ObjHash).Keys))}
+			}},
+			"keys": {0, func(self object.Object, args []object.Object) object.Object {
+				hash := self.(*object.ObjHash)
+				keys := make([]object.Object, len(hash.Keys))
+				for i, key := range hash.Keys {
+					keys[i] = hash.Pairs[key].Key
+				}
+				return &object.ObjArray{Elems: keys}
+			}},
+			"values": {0, func(self object.Object, args []object.Object) object.Object {
+				hash := self.(*object.ObjHash)
+				values := make([]object.Object, len(hash.Keys))
+				for i, key := range hash.Keys {
+					values[i] = hash.Pairs[key].Value
+				}
+				return &object.ObjArray{Elems: values}
+			}},
+			"has": {1, func(self object.Object, args []object.Object) object.Object {
+				key, ok := args[0].(object.Hashable)
+				if !ok {
+					return errorf(object.TypeError, "unusable as hash key: %s", args[0].Type())
+				}
+				_, found := self.(*object.ObjHash).Get(key)
+				return getBool(found)
+			}},
+		},
+		object.ObjTypeGenerator: {
+			"next": {0, func(self object.Object, args []object.Object) object.Object {
+				if val, ok := self.(*object.ObjGenerator).Next(); ok {
+					return val
+				}
+				return nullObj
+			}},
+			"close": {0, func(self object.Object, args []object.Object) object.Object {
+				if err := self.(*object.ObjGenerator).Close(); err != nil {
+					return err
+				}
+				return nullObj
+			}},
+		},
+		object.ObjTypeChan: {
+			"send": {1, func(self object.Object, args []object.Object) object.Object {
+				return chanOp(self.(*object.ObjChan), true, args[0])
+			}},
+			"recv": {0, func(self object.Object, args []object.Object) object.Object {
+				return chanOp(self.(*object.ObjChan), false, nil)
+			}},
+			"close": {0, func(self object.Object, args []object.Object) object.Object {
+				if err := closeChan(self.(*object.ObjChan)); err != nil {
+					return err
+				}
+				return nullObj
+			}},
+			"len": {0, func(self object.Object, args []object.Object) object.Object {
+				return &object.ObjInt{Value: int64(len(self.(*object.ObjChan).Buf))}
+			}},
+		},
+		object.ObjTypeTask: {
+			"wait": {0, func(self object.Object, args []object.Object) object.Object {
+				task := self.(*object.ObjTask)
+				if val := chanOp(task.Done, false, nil); isError(val) {
+					return val
+				}
+				return task.Result
+			}},
+		},
+		object.ObjTypeRegex: {
+			"match": {1, func(self object.Object, args []object.Object) object.Object {
+				s, ok := args[0].(*object.ObjString)
+				if !ok {
+					return errorf(object.TypeError, "match: expected string, got %s", args[0].Type())
+				}
+				re := self.(*object.ObjRegex).Value
+				if match := re.FindStringSubmatchIndex(s.Value); match != nil {
+					return submatches(s.Value, match)
+				}
+				return nullObj
+			}},
+			"find_all": {1, func(self object.Object, args []object.Object) object.Object {
+				s, ok := args[0].(*object.ObjString)
+				if !ok {
+					return errorf(object.TypeError, "find_all: expected string, got %s", args[0].Type())
+				}
+				re := self.(*object.ObjRegex).Value
+				var elems []object.Object
+				for _, match := range re.FindAllStringSubmatchIndex(s.Value, -1) {
+					if re.NumSubexp() == 0 {
+						elems = append(elems, &object.ObjString{Value: s.Value[match[0]:match[1]]})
+					} else {
+						elems = append(elems, submatches(s.Value, match))
+					}
+				}
+				return &object.ObjArray{Elems: elems}
+			}},
+			"replace": {2, func(self object.Object, args []object.Object) object.Object {
+				s, ok := args[0].(*object.ObjString)
+				if !ok {
+					return errorf(object.TypeError, "replace: expected string, got %s", args[0].Type())
+				}
+				re := self.(*object.ObjRegex).Value
+				if repl, ok := args[1].(*object.ObjString); ok {
+					return &object.ObjString{Value: re.ReplaceAllString(s.Value, repl.Value)}
+				}
+				// Otherwise the replacement is computed from each match.
+				var out strings.Builder
+				last := 0
+				for _, match := range re.FindAllStringSubmatchIndex(s.Value, -1) {
+					repl := applyFunc(args[1], []object.Object{submatches(s.Value, match)}, nil)
+					if isError(repl) {
+						return repl
+					}
+					str, ok := repl.(*object.ObjString)
+					if !ok {
+						return errorf(object.TypeError, "replace: expected the replacement to be string, got %s", repl.Type())
+					}
+					out.WriteString(s.Value[last:match[0]])
+					out.WriteString(str.Value)
+					last = match[1]
+				}
+				out.WriteString(s.Value[last:])
+				return &object.ObjString{Value: out.String()}
+			}},
+			"split": {1, func(self object.Object, args []object.Object) object.Object {
+				s, ok := args[0].(*object.ObjString)
+				if !ok {
+					return errorf(object.TypeError, "split: expected string, got %s", args[0].Type())
+				}
+				parts := self.(*object.ObjRegex).Value.Split(s.Value, -1)
+				elems := make([]object.Object, len(parts))
+				for i, part := range parts {
+					elems[i] = &object.ObjString{Value: part}
+				}
+				return &object.ObjArray{Elems: elems}
+			}},
+		},
+		object.ObjTypeStruct: {
+			"is": {1, func(self object.Object, args []object.Object) object.Object {
+				switch typ := args[0].(type) {
+				case *object.ObjStructType:
+					return getBool(self.(*object.ObjStruct).StructType == typ)
+				case *object.ObjStruct:
+					return getBool(self.(*object.ObjStruct).StructType == typ.StructType)
+				default:
+					return errorf(object.TypeError, "is: expected struct type, got %s", args[0].Type())
+				}
+			}},
+		},
+	}
+}
+
+// submatches returns the text of a match and its groups, with null for groups
+// that did not participate in it.
+func submatches(s string, match []int) *object.ObjArray {
+	elems := make([]object.Object, len(match)/2)
+	for i := range elems {
+		if match[2*i] < 0 {
+			elems[i] = nullObj
+		} else {
+			elems[i] = &object.ObjString{Value: s[match[2*i]:match[2*i+1]]}
+		}
+	}
+	return &object.ObjArray{Elems: elems}
+}
+
+func evalMemberExpr(obj object.Object, name string) object.Object {
+	switch obj := obj.(type) {
+	case *object.ObjHash:
+		if val, ok := obj.Get(&object.ObjString{Value: name}); ok {
+			return val
+		}
+		// Like indexing, a missing key is null, unless it names a method.
+		if _, ok := methods[obj.Type()][name]; !ok {
+			return nullObj
+		}
+	case *object.ObjModule:
+		if b, ok := obj.Exports[name]; ok {
+			return b.Value
+		}
+		return errorf(object.NameError, "module %s has no export %s", obj.Name, name)
+	case *object.ObjStruct:
+		if val, ok := obj.Field(name); ok {
+			return val
+		}
+		if method, ok := obj.StructType.Methods[name]; ok {
+			return &object.ObjBoundMethod{Self: obj, Func: method}
+		}
+		if _, ok := methods[obj.Type()][name]; !ok {
+			return errorf(object.NameError, "%s has no field %s", obj.StructType.Name, name)
+		}
+	case *object.ObjStructType:
+		if method, ok := obj.Methods[name]; ok {
+			return method
+		}
+	case *object.ObjEnum:
+		variant, ok := obj.Variant(name)
+		if !ok {
+			if method, ok := obj.Methods[name]; ok {
+				return method
+			}
+			return errorf(object.NameError, "enum %s has no variant %s", obj.Name, name)
+		}
+		if len(variant.Fields) == 0 {
+			return &object.ObjStruct{StructType: variant}
+		}
+		return variant
+	}
+	m, ok := methods[obj.Type()][name]
+	if !ok {
+		return errorf(object.NameError, "unknown member %s for %s", name, obj.Type())
+	}
+	return &object.ObjBuiltin{
+		Name: obj.Type().String() + "." + name,
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != m.arity {
+				return errorf(object.ArgumentError, "wrong number of arguments to %s.%s: expected %d, got %d", obj.Type(), name, m.arity, len(args))
+			}
+			return m.fn(obj, args)
+		},
+	}
+}
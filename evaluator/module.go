@@ -0,0 +1,140 @@
+package evaluator
+
+import (
+	"io/ioutil"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/token"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const moduleExt = ".monkey"
+
+var (
+	modules = make(map[string]*object.ObjModule)
+	// Files currently being evaluated, innermost last.
+	loading []string
+)
+
+// EvalModule evaluates prog as the contents of file, so that its imports
+// resolve relative to it.
+func EvalModule(prog *ast.Program, file string, env object.Env) object.Object {
+	if abs, err := filepath.Abs(file); err == nil {
+		file = abs
+	}
+	loading = append(loading, file)
+	defer func() { loading = loading[:len(loading)-1] }()
+	return Eval(prog, env)
+}
+
+func importModule(name string) object.Object {
+	file, err := resolveModule(name)
+	if err != nil {
+		return err
+	}
+	if module, ok := modules[file]; ok {
+		return module
+	}
+	for i, f := range loading {
+		if f == file {
+			chain := make([]string, 0, len(loading)-i+1)
+			for _, f := range append(loading[i:], file) {
+				chain = append(chain, displayPath(f))
+			}
+			return errorf(object.ImportError, "import cycle: %s", strings.Join(chain, " -> "))
+		}
+	}
+
+	input, readErr := ioutil.ReadFile(file)
+	if readErr != nil {
+		return errorf(object.ImportError, "cannot read module %s: %s", name, readErr)
+	}
+	ch := make(chan *token.Token)
+	p := parser.New(lexer.New(string(input), ch), ch)
+	prog := p.Parse()
+	if len(p.Errors) > 0 {
+		errs := make([]string, len(p.Errors))
+		for i, e := range p.Errors {
+			errs[i] = e.String()
+		}
+		return errorf(object.ImportError, "in module %s: %s", name, strings.Join(errs, "; "))
+	}
+
+	macros := object.NewEnv(nil)
+	DefineMacros(prog, macros)
+	prog, macroErr := ExpandMacros(prog, macros)
+	if macroErr != nil {
+		macroErr.Stack = append(macroErr.Stack, "module "+name)
+		return macroErr
+	}
+
+	env := object.NewEnv(nil)
+	if ret, ok := EvalModule(prog, file, env).(*object.ObjError); ok {
+		ret.Stack = append(ret.Stack, "module "+name)
+		return ret
+	}
+	module := &object.ObjModule{Name: name, Exports: make(map[string]*object.Binding)}
+	for _, stmt := range prog.Stmts {
+		if stmt, ok := stmt.(*ast.ExportStmt); ok {
+			for _, id := range declaredNames(stmt.Stmt) {
+				if b, ok := env.Local(id); ok {
+					module.Exports[id] = b
+				}
+			}
+		}
+	}
+	modules[file] = module
+	return module
+}
+
+func resolveModule(name string) (string, *object.ObjError) {
+	if filepath.Ext(name) == "" {
+		name += moduleExt
+	}
+	dirs := []string{"."}
+	if len(loading) > 0 {
+		dirs[0] = filepath.Dir(loading[len(loading)-1])
+	}
+	dirs = append(dirs, filepath.SplitList(os.Getenv("MONKEYPATH"))...)
+	if filepath.IsAbs(name) {
+		dirs = []string{""}
+	}
+	for _, dir := range dirs {
+		file := filepath.Join(dir, name)
+		if info, err := os.Stat(file); err == nil && !info.IsDir() {
+			if abs, err := filepath.Abs(file); err == nil {
+				return abs, nil
+			}
+			return file, nil
+		}
+	}
+	return "", errorf(object.ImportError, "module not found: %s", name)
+}
+
+func displayPath(file string) string {
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, file); err == nil && !strings.HasPrefix(rel, "..") {
+			return rel
+		}
+	}
+	return file
+}
+
+func declaredNames(stmt ast.Stmt) []string {
+	switch stmt := stmt.(type) {
+	case *ast.LetStmt:
+		return ast.PatternNames(stmt.Name)
+	case *ast.FuncStmt:
+		return []string{stmt.Name.Value}
+	case *ast.StructStmt:
+		return []string{stmt.Name.Value}
+	case *ast.EnumStmt:
+		return []string{stmt.Name.Value}
+	default:
+		return nil
+	}
+}
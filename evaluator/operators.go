@@ -0,0 +1,116 @@
+package evaluator
+
+import (
+	"monkey/object"
+	"strings"
+)
+
+var infixHooks = map[string]string{
+	"+": "__add__",
+	"-": "__sub__",
+	"*": "__mul__",
+	"/": "__div__",
+	"%": "__mod__",
+}
+
+func findMethod(obj object.Object, name string) (*object.ObjFunc, bool) {
+	s, ok := obj.(*object.ObjStruct)
+	if !ok {
+		return nil, false
+	}
+	method, ok := s.StructType.Methods[name]
+	return method, ok
+}
+
+// callHook calls the named method of obj if it is a user type defining it.
+func callHook(obj object.Object, name string, args ...object.Object) (object.Object, bool) {
+	method, ok := findMethod(obj, name)
+	if !ok {
+		return nil, false
+	}
+	return applyUserFunc(method, append([]object.Object{obj}, args...), nil), true
+}
+
+// evalInfixHook dispatches op to the left operand's hook. Comparisons are all
+// derived from __eq__ and __lt__, so a > b calls b.__lt__(a).
+func evalInfixHook(op string, left, right object.Object) (object.Object, bool) {
+	if name, ok := infixHooks[op]; ok {
+		return callHook(left, name, right)
+	}
+	var ret object.Object
+	var ok bool
+	switch op {
+	case "==", "!=":
+		ret, ok = callHook(left, "__eq__", right)
+	case "<", ">=":
+		ret, ok = callHook(left, "__lt__", right)
+	case ">", "<=":
+		ret, ok = callHook(right, "__lt__", left)
+	}
+	if !ok || isError(ret) {
+		return ret, ok
+	}
+	switch op {
+	case "==", "<", ">":
+		return getBool(isTruthy(ret)), true
+	default:
+		return getBool(!isTruthy(ret)), true
+	}
+}
+
+// Inspect renders o for display, using the __str__ hooks of user types. An
+// error raised by a hook is returned instead.
+func Inspect(o object.Object) (string, *object.ObjError) {
+	switch o := o.(type) {
+	case *object.ObjStruct:
+		if ret, ok := callHook(o, "__str__"); ok {
+			switch ret := ret.(type) {
+			case *object.ObjError:
+				return "", ret
+			case *object.ObjString:
+				return ret.Value, nil
+			default:
+				return ret.String(), nil
+			}
+		}
+		if o.StructType.Enum != nil && len(o.Values) == 0 {
+			return o.StructType.Name, nil
+		}
+		fields := make([]string, len(o.Values))
+		for i, val := range o.Values {
+			str, err := Inspect(val)
+			if err != nil {
+				return "", err
+			}
+			fields[i] = o.StructType.Fields[i] + ": " + str
+		}
+		return o.StructType.Name + "{" + strings.Join(fields, ", ") + "}", nil
+	case *object.ObjArray:
+		elems := make([]string, len(o.Elems))
+		for i, elem := range o.Elems {
+			str, err := Inspect(elem)
+			if err != nil {
+				return "", err
+			}
+			elems[i] = str
+		}
+		return "[" + strings.Join(elems, ", ") + "]", nil
+	case *object.ObjHash:
+		pairs := make([]string, len(o.Keys))
+		for i, key := range o.Keys {
+			pair := o.Pairs[key]
+			k, err := Inspect(pair.Key)
+			if err != nil {
+				return "", err
+			}
+			v, err := Inspect(pair.Value)
+			if err != nil {
+				return "", err
+			}
+			pairs[i] = k + ": " + v
+		}
+		return "{" + strings.Join(pairs, ", ") + "}", nil
+	default:
+		return o.String(), nil
+	}
+}
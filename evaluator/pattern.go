@@ -0,0 +1,116 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+)
+
+func bindPattern(pattern ast.Pattern, val object.Object, env object.Env, constant bool) *object.ObjError {
+	switch pattern := pattern.(type) {
+	case *ast.IdentExpr:
+		if pattern.Value == "_" {
+			break
+		}
+		if b, ok := env.Local(pattern.Value); ok && b.Const {
+			return errorf(object.ConstError, "cannot redeclare constant %s%s", pattern.Value, declaredAt(b))
+		}
+		env.Declare(pattern.Value, val, constant, pattern.Token)
+
+	case *ast.TypedPattern:
+		// Annotations are left to the checker.
+		return bindPattern(pattern.Pattern, val, env, constant)
+
+	case *ast.IntLiteralExpr, *ast.StringExpr, *ast.BoolExpr, *ast.NullExpr:
+		if eq, err := objectsEqual(Eval(pattern, env), val); err != nil {
+			return err
+		} else if !eq {
+			return errorf(object.MatchError, "pattern %s: got %s", pattern, val)
+		}
+
+	case *ast.ArrayPattern:
+		arr, ok := val.(*object.ObjArray)
+		if !ok {
+			return errorf(object.MatchError, "pattern %s: expected array, got %s", pattern, val.Type())
+		}
+		if len(arr.Elems) < len(pattern.Elems) || pattern.Rest == nil && len(arr.Elems) > len(pattern.Elems) {
+			return errorf(object.MatchError, "pattern %s: expected %d elements, got %d", pattern, len(pattern.Elems), len(arr.Elems))
+		}
+		for i, elem := range pattern.Elems {
+			if err := bindPattern(elem, arr.Elems[i], env, constant); err != nil {
+				return err
+			}
+		}
+		if pattern.Rest != nil {
+			rest := make([]object.Object, len(arr.Elems)-len(pattern.Elems))
+			copy(rest, arr.Elems[len(pattern.Elems):])
+			if err := bindPattern(pattern.Rest, &object.ObjArray{Elems: rest}, env, constant); err != nil {
+				return err
+			}
+		}
+
+	case *ast.HashPattern:
+		var get func(key string) (object.Object, bool)
+		switch val := val.(type) {
+		case *object.ObjHash:
+			get = func(key string) (object.Object, bool) { return val.Get(&object.ObjString{Value: key}) }
+		case *object.ObjStruct:
+			get = val.Field
+		default:
+			return errorf(object.MatchError, "pattern %s: expected hash, got %s", pattern, val.Type())
+		}
+		for _, entry := range pattern.Entries {
+			entryVal, ok := get(entry.Key)
+			if !ok {
+				return errorf(object.MatchError, "pattern %s: missing key %q", pattern, entry.Key)
+			}
+			if err := bindPattern(entry.Value, entryVal, env, constant); err != nil {
+				return err
+			}
+		}
+
+	case *ast.ConstructorPattern:
+		typ := Eval(pattern.Type, env)
+		if err, ok := typ.(*object.ObjError); ok {
+			return err
+		}
+		structType, ok := typ.(*object.ObjStructType)
+		if !ok {
+			// A variant without fields evaluates to its only value.
+			if pattern.Args != nil {
+				return errorf(object.TypeError, "pattern %s: not a struct type: %s", pattern, typ.Type())
+			}
+			if eq, err := objectsEqual(typ, val); err != nil {
+				return err
+			} else if !eq {
+				return errorf(object.MatchError, "pattern %s: got %s", pattern, val)
+			}
+			break
+		}
+		s, ok := val.(*object.ObjStruct)
+		if !ok || s.StructType != structType {
+			return errorf(object.MatchError, "pattern %s: got %s", pattern, val)
+		}
+		if pattern.Args == nil {
+			break
+		}
+		if len(pattern.Args) != len(s.Values) {
+			return errorf(object.TypeError, "pattern %s: expected %d fields, got %d", pattern, len(s.Values), len(pattern.Args))
+		}
+		for i, arg := range pattern.Args {
+			if err := bindPattern(arg, s.Values[i], env, constant); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return errorf(object.MatchError, "invalid pattern: %s", pattern)
+	}
+	return nil
+}
+
+func untyped(pattern ast.Pattern) ast.Pattern {
+	if typed, ok := pattern.(*ast.TypedPattern); ok {
+		return typed.Pattern
+	}
+	return pattern
+}
@@ -0,0 +1,202 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+	"sync"
+)
+
+// Tasks share environments, so only the task holding the interpreter lock
+// runs; it is released only while a task is blocked on a channel. The main
+// task holds it from the start.
+var (
+	gil     sync.Mutex
+	tasks   = 1
+	blocked int
+	parked  = make(map[*object.Selection]bool)
+)
+
+func init() { gil.Lock() }
+
+type chanCase struct {
+	ch   *object.ObjChan
+	send bool
+	val  object.Object
+}
+
+func spawn(name string, call func() object.Object) *object.ObjTask {
+	task := &object.ObjTask{Name: name, Done: &object.ObjChan{}}
+	tasks++
+	go func() {
+		gil.Lock()
+		defer gil.Unlock()
+		depth = 0
+		task.Result = call()
+		tasks--
+		closeChan(task.Done)
+		if blocked > 0 && blocked == tasks {
+			deadlock()
+		}
+	}()
+	return task
+}
+
+// selectCase performs the first ready operation in cases, or parks the task
+// until one is. With a default case it returns -1 instead of blocking.
+func selectCase(cases []chanCase, hasDefault bool) (int, object.Object, *object.ObjError) {
+	for i, c := range cases {
+		if c.send {
+			if c.ch.Closed {
+				return i, nil, errorf(object.ChannelError, "send on closed channel")
+			}
+			if w := popWaiter(&c.ch.Recvq); w != nil {
+				wake(w, c.val, nil)
+				return i, nullObj, nil
+			}
+			if len(c.ch.Buf) < c.ch.Cap {
+				c.ch.Buf = append(c.ch.Buf, c.val)
+				return i, nullObj, nil
+			}
+			continue
+		}
+		if len(c.ch.Buf) > 0 {
+			val := c.ch.Buf[0]
+			c.ch.Buf = c.ch.Buf[1:]
+			if w := popWaiter(&c.ch.Sendq); w != nil {
+				c.ch.Buf = append(c.ch.Buf, w.Value)
+				wake(w, nullObj, nil)
+			}
+			return i, val, nil
+		}
+		if w := popWaiter(&c.ch.Sendq); w != nil {
+			wake(w, nullObj, nil)
+			return i, w.Value, nil
+		}
+		if c.ch.Closed {
+			return i, nullObj, nil
+		}
+	}
+	if hasDefault {
+		return -1, nullObj, nil
+	}
+
+	sel := &object.Selection{Wake: make(chan struct{})}
+	for i, c := range cases {
+		w := &object.Waiter{Sel: sel, Case: i, Value: c.val}
+		if c.send {
+			c.ch.Sendq = append(c.ch.Sendq, w)
+		} else {
+			c.ch.Recvq = append(c.ch.Recvq, w)
+		}
+	}
+	parked[sel] = true
+	blocked++
+	if blocked == tasks {
+		deadlock()
+	}
+	// Every task has its own call depth.
+	saved := depth
+	gil.Unlock()
+	<-sel.Wake
+	gil.Lock()
+	depth = saved
+	return sel.Case, sel.Value, sel.Err
+}
+
+// popWaiter dequeues the first waiter whose task has not been woken yet by
+// another case of its select.
+func popWaiter(q *[]*object.Waiter) *object.Waiter {
+	for len(*q) > 0 {
+		w := (*q)[0]
+		*q = (*q)[1:]
+		if !w.Sel.Done {
+			return w
+		}
+	}
+	return nil
+}
+
+func wake(w *object.Waiter, val object.Object, err *object.ObjError) {
+	w.Sel.Case = w.Case
+	release(w.Sel, val, err)
+}
+
+func release(sel *object.Selection, val object.Object, err *object.ObjError) {
+	sel.Done, sel.Value, sel.Err = true, val, err
+	delete(parked, sel)
+	blocked--
+	close(sel.Wake)
+}
+
+func closeChan(ch *object.ObjChan) *object.ObjError {
+	if ch.Closed {
+		return errorf(object.ChannelError, "close of closed channel")
+	}
+	ch.Closed = true
+	for w := popWaiter(&ch.Recvq); w != nil; w = popWaiter(&ch.Recvq) {
+		wake(w, nullObj, nil)
+	}
+	for w := popWaiter(&ch.Sendq); w != nil; w = popWaiter(&ch.Sendq) {
+		wake(w, nil, errorf(object.ChannelError, "send on closed channel"))
+	}
+	return nil
+}
+
+// deadlock fails every parked task, since none of them can ever be woken.
+func deadlock() {
+	for sel := range parked {
+		release(sel, nil, errorf(object.DeadlockError, "deadlock: all tasks are blocked"))
+	}
+}
+
+func chanOp(ch *object.ObjChan, send bool, val object.Object) object.Object {
+	_, val, err := selectCase([]chanCase{{ch: ch, send: send, val: val}}, false)
+	if err != nil {
+		return err
+	}
+	return val
+}
+
+func evalSelectExpr(n *ast.SelectExpr, env object.Env) object.Object {
+	var cases []chanCase
+	var arms []*ast.SelectCase
+	var def *ast.SelectCase
+	for _, c := range n.Cases {
+		if c.Op == nil {
+			def = c
+			continue
+		}
+		member := c.Op.Func.(*ast.MemberExpr)
+		obj := Eval(member.Object, env)
+		if isError(obj) {
+			return obj
+		}
+		ch, ok := obj.(*object.ObjChan)
+		if !ok {
+			return at(member.Token, errorf(object.TypeError, "select on %s, expected chan", obj.Type()))
+		}
+		cc := chanCase{ch: ch, send: member.Member.Value == "send"}
+		if cc.send {
+			if cc.val = Eval(c.Op.Args[0], env); isError(cc.val) {
+				return cc.val
+			}
+		}
+		cases = append(cases, cc)
+		arms = append(arms, c)
+	}
+	i, val, err := selectCase(cases, def != nil)
+	if err != nil {
+		return at(n.Token, err)
+	}
+	arm := def
+	if i >= 0 {
+		arm = arms[i]
+	}
+	armenv := object.NewEnv(&env)
+	if arm.Binding != nil {
+		if err := bindPattern(arm.Binding, val, armenv, false); err != nil {
+			return at(n.Token, err)
+		}
+	}
+	return Eval(arm.Body, armenv)
+}
@@ -13,6 +13,8 @@ type Lexer struct {
 	ch         chan<- *token.Token
 	row        int
 	lastRowPos int
+	last       token.TokenType
+	doc        []string
 }
 
 func New(input string, ch chan<- *token.Token) *Lexer {
@@ -62,11 +64,44 @@ func (l *Lexer) consume() string {
 
 func (l *Lexer) emit(t token.TokenType) {
 	col := 1 + l.start - l.lastRowPos
+	l.last = t
 	l.ch <- &token.Token{
 		Type:    t,
 		Literal: l.consume(),
 		Row:     l.row,
 		Col:     col,
+		Doc:     strings.Join(l.doc, "\n"),
+	}
+	l.doc = nil
+}
+
+// Like Go, a newline ends the statement if the line's last token could end one.
+var semicolonInsertingTokens = map[token.TokenType]bool{
+	token.Ident:    true,
+	token.Int:      true,
+	token.DQuote:   true,
+	token.True:     true,
+	token.False:    true,
+	token.Null:     true,
+	token.Return:   true,
+	token.Yield:    true,
+	token.Break:    true,
+	token.Continue: true,
+	token.RParen:   true,
+	token.RBracket: true,
+	token.RBrace:   true,
+}
+
+func (l *Lexer) insertSemicolon() {
+	if !semicolonInsertingTokens[l.last] {
+		return
+	}
+	l.last = token.Semicolon
+	l.ch <- &token.Token{
+		Type:    token.Semicolon,
+		Literal: "\n",
+		Row:     l.row,
+		Col:     l.pos - l.lastRowPos,
 	}
 }
 
@@ -77,19 +112,36 @@ func (l *Lexer) Parse() {
 	for l.r != 0 {
 		l.readWhile(func(r rune) bool {
 			if r == '\n' {
+				l.insertSemicolon()
 				l.row++
 				l.lastRowPos = l.pos + 1
 			}
 			return IsWhitespace(r)
 		})
 		l.consume()
+		if l.r == 0 {
+			break
+		}
 
 		switch {
+		case l.r == '/' && l.peek() == '/':
+			l.readWhile(func(r rune) bool { return r != '\n' && r != 0 })
+			if comment := l.consume(); strings.HasPrefix(comment, "///") {
+				l.doc = append(l.doc, strings.TrimPrefix(comment[3:], " "))
+			}
+
 		case IsValidIdentifierHead(l.r):
 			l.readWhile(IsValidIdentifierRune)
-			if keywordType, ok := token.Keywords[l.read()]; ok {
+			keywordType, isKeyword := token.Keywords[l.read()]
+			// After a dot, keywords are member names, as in `r.match(s)`.
+			isMember := l.last == token.Dot || l.last == token.OptChain
+			switch {
+			case l.read() == "re" && l.r == '"':
+				// The prefix of a regex literal, re"...".
+				l.emit(token.Regex)
+			case isKeyword && !isMember:
 				l.emit(keywordType)
-			} else {
+			default:
 				l.emit(token.Ident)
 			}
 
@@ -74,6 +74,149 @@ func TestTokenize(t *testing.T) {
 	}
 }
 
+func TestSemicolonInsertion(t *testing.T) {
+	input := `let x = 1
+	let s = "a"
+	f(x)
+	return
+	xs[0] +
+	y;
+	{}
+	`
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.Let, "let"},
+		{token.Ident, "x"},
+		{token.Assign, "="},
+		{token.Int, "1"},
+		{token.Semicolon, "\n"},
+		{token.Let, "let"},
+		{token.Ident, "s"},
+		{token.Assign, "="},
+		{token.DQuote, "\""},
+		{token.String, "a"},
+		{token.DQuote, "\""},
+		{token.Semicolon, "\n"},
+		{token.Ident, "f"},
+		{token.LParen, "("},
+		{token.Ident, "x"},
+		{token.RParen, ")"},
+		{token.Semicolon, "\n"},
+		{token.Return, "return"},
+		{token.Semicolon, "\n"},
+		{token.Ident, "xs"},
+		{token.LBracket, "["},
+		{token.Int, "0"},
+		{token.RBracket, "]"},
+		{token.Plus, "+"},
+		{token.Ident, "y"},
+		{token.Semicolon, ";"},
+		{token.LBrace, "{"},
+		{token.RBrace, "}"},
+		{token.Semicolon, "\n"},
+		{token.EOF, ""},
+	}
+
+	ch := make(chan *token.Token)
+	l := New(input, ch)
+	go l.Parse()
+
+	for i, tt := range tests {
+		tok := <-ch
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d]: expected type %q, got type %q",
+				i, tt.expectedType.String(), tok.Type.String())
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d]: expected literal %q, got literal %q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// A comment.
+	/// Adds one.
+	///Really.
+	fn inc(x) { x / 1 } // trailing
+	let y = 2`
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedDoc     string
+	}{
+		{token.Function, "fn", "Adds one.\nReally."},
+		{token.Ident, "inc", ""},
+		{token.LParen, "(", ""},
+		{token.Ident, "x", ""},
+		{token.RParen, ")", ""},
+		{token.LBrace, "{", ""},
+		{token.Ident, "x", ""},
+		{token.Slash, "/", ""},
+		{token.Int, "1", ""},
+		{token.RBrace, "}", ""},
+		{token.Semicolon, "\n", ""},
+		{token.Let, "let", ""},
+	}
+
+	ch := make(chan *token.Token)
+	l := New(input, ch)
+	go l.Parse()
+
+	for i, tt := range tests {
+		tok := <-ch
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d]: expected %q %q, got %q %q",
+				i, tt.expectedType.String(), tt.expectedLiteral, tok.Type.String(), tok.Literal)
+		}
+		if tok.Doc != tt.expectedDoc {
+			t.Errorf("tests[%d]: expected doc %q, got %q", i, tt.expectedDoc, tok.Doc)
+		}
+	}
+}
+
+func TestRegex(t *testing.T) {
+	input := `re"\d+ \"x\"" re "a" are"b" r.match(s) match`
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.Regex, "re"},
+		{token.DQuote, "\""},
+		{token.String, `\d+ \"x\"`},
+		{token.DQuote, "\""},
+		{token.Ident, "re"},
+		{token.DQuote, "\""},
+		{token.String, "a"},
+		{token.DQuote, "\""},
+		{token.Ident, "are"},
+		{token.DQuote, "\""},
+		{token.String, "b"},
+		{token.DQuote, "\""},
+		{token.Ident, "r"},
+		{token.Dot, "."},
+		{token.Ident, "match"},
+		{token.LParen, "("},
+		{token.Ident, "s"},
+		{token.RParen, ")"},
+		{token.Match, "match"},
+	}
+
+	ch := make(chan *token.Token)
+	l := New(input, ch)
+	go l.Parse()
+
+	for i, tt := range tests {
+		tok := <-ch
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d]: expected %q %q, got %q %q",
+				i, tt.expectedType.String(), tt.expectedLiteral, tok.Type.String(), tok.Literal)
+		}
+	}
+}
+
 func TestError(t *testing.T) {
 	input := `let x = 3;
 	let y = "hello";`
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"monkey/ast"
+	"monkey/checker"
 	"monkey/evaluator"
 	"monkey/lexer"
 	"monkey/object"
@@ -11,30 +13,91 @@ import (
 	"monkey/repl"
 	"monkey/token"
 	"os"
+	"strconv"
 )
 
 func main() {
+	if limit := os.Getenv("MONKEYMAXDEPTH"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			log.Fatalf("invalid MONKEYMAXDEPTH: %q", limit)
+		}
+		evaluator.MaxDepth = n
+	}
+
 	if len(os.Args) == 1 {
 		repl.Repl()
 		return
 	}
 
-	input, err := ioutil.ReadFile(os.Args[1])
+	if os.Args[1] == "check" {
+		if len(os.Args) < 3 {
+			log.Fatal("usage: monkey check file...")
+		}
+		ok := true
+		for _, file := range os.Args[2:] {
+			ok = check(file) && ok
+		}
+		if !ok {
+			os.Exit(1)
+		}
+		return
+	}
+
+	prog, ok := load(os.Args[1])
+	if !ok {
+		return
+	}
+
+	ret := evaluator.EvalModule(prog, os.Args[1], object.NewEnv(nil))
+	if err, ok := ret.(*object.ObjError); ok {
+		fmt.Println(err.Trace())
+		return
+	}
+	str, err := evaluator.Inspect(ret)
+	if err != nil {
+		fmt.Println(err.Trace())
+		return
+	}
+	fmt.Println(str)
+}
+
+// load parses file and expands its macros, printing any errors.
+func load(file string) (*ast.Program, bool) {
+	input, err := ioutil.ReadFile(file)
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	ch := make(chan *token.Token)
-	p := parser.New(lexer.New(string(input)[:len(input)-1], ch), ch)
+	p := parser.New(lexer.New(string(input), ch), ch)
 	prog := p.Parse()
 
 	if len(p.Errors) > 0 {
 		for _, err := range p.Errors {
 			println(err.String())
 		}
-		return
+		return nil, false
+	}
+
+	macros := object.NewEnv(nil)
+	evaluator.DefineMacros(prog, macros)
+	prog, macroErr := evaluator.ExpandMacros(prog, macros)
+	if macroErr != nil {
+		fmt.Println(macroErr.Trace())
+		return nil, false
 	}
+	return prog, true
+}
 
-	ret := evaluator.Eval(prog, object.NewEnv(nil))
-	fmt.Println(ret.String())
+func check(file string) bool {
+	prog, ok := load(file)
+	if !ok {
+		return false
+	}
+	errs := checker.Check(prog)
+	for _, err := range errs {
+		fmt.Printf("%s: %s\n", file, err.String())
+	}
+	return len(errs) == 0
 }
@@ -0,0 +1,40 @@
+package object
+
+import "fmt"
+
+type ObjChan struct {
+	Cap    int
+	Buf    []Object
+	Closed bool
+	Recvq  []*Waiter
+	Sendq  []*Waiter
+}
+
+// Selection is a task blocked on one or more channel operations. Wake is
+// closed once one of them completes, or the task has to give up.
+type Selection struct {
+	Done  bool
+	Case  int
+	Value Object
+	Err   *ObjError
+	Wake  chan struct{}
+}
+
+// Waiter queues one operation of a Selection on a channel.
+type Waiter struct {
+	Sel   *Selection
+	Case  int
+	Value Object // The value to send.
+}
+
+type ObjTask struct {
+	Name   string
+	Done   *ObjChan // Closed when the task finishes.
+	Result Object
+}
+
+func (o *ObjChan) Type() ObjectType { return ObjTypeChan }
+func (o *ObjChan) String() string   { return fmt.Sprintf("<chan %d/%d>", len(o.Buf), o.Cap) }
+
+func (o *ObjTask) Type() ObjectType { return ObjTypeTask }
+func (o *ObjTask) String() string   { return fmt.Sprintf("<task %s>", o.Name) }
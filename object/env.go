@@ -1,25 +1,66 @@
 package object
 
+import "monkey/token"
+
+type Binding struct {
+	Value Object
+	Const bool
+	Token *token.Token
+}
+
+// Frame holds the state of a single function call, shared by all the
+// scopes nested in its body.
+type Frame struct {
+	Defers []func() Object
+	// Set for generators; returns an error if the generator must stop.
+	Yield func(Object) *ObjError
+	// Set for calls whose returns can be tail calls, which generators' can't.
+	TailCalls bool
+	// The number of try expressions being evaluated.
+	Tries int
+}
+
 type Env struct {
-	store map[string]Object
+	store map[string]*Binding
 	outer *Env
+	Frame *Frame
 }
 
 func NewEnv(outer *Env) Env {
-	return Env{
-		store: make(map[string]Object),
+	env := Env{
+		store: make(map[string]*Binding),
 		outer: outer,
 	}
+	if outer != nil {
+		env.Frame = outer.Frame
+	}
+	return env
 }
 
 func (e *Env) Get(id string) (Object, bool) {
-	obj, ok := e.store[id]
-	if !ok && e.outer != nil {
-		return e.outer.Get(id)
+	if b, ok := e.Resolve(id); ok {
+		return b.Value, true
 	}
-	return obj, ok
+	return nil, false
 }
 
 func (e *Env) Set(id string, o Object) {
-	e.store[id] = o
+	e.store[id] = &Binding{Value: o}
+}
+
+func (e *Env) Declare(id string, o Object, constant bool, tok *token.Token) {
+	e.store[id] = &Binding{Value: o, Const: constant, Token: tok}
+}
+
+func (e *Env) Local(id string) (*Binding, bool) {
+	b, ok := e.store[id]
+	return b, ok
+}
+
+func (e *Env) Resolve(id string) (*Binding, bool) {
+	b, ok := e.store[id]
+	if !ok && e.outer != nil {
+		return e.outer.Resolve(id)
+	}
+	return b, ok
 }
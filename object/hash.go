@@ -0,0 +1,38 @@
+package object
+
+import "fmt"
+
+type HashKey struct {
+	Type  ObjectType
+	Value string
+}
+
+type HashPair struct {
+	Key, Value Object
+}
+
+type Hashable interface {
+	Object
+	HashKey() HashKey
+}
+
+func (o *ObjInt) HashKey() HashKey    { return HashKey{Type: o.Type(), Value: fmt.Sprint(o.Value)} }
+func (o *ObjBool) HashKey() HashKey   { return HashKey{Type: o.Type(), Value: fmt.Sprint(o.Value)} }
+func (o *ObjString) HashKey() HashKey { return HashKey{Type: o.Type(), Value: o.Value} }
+
+func NewHash() *ObjHash {
+	return &ObjHash{Pairs: make(map[HashKey]HashPair)}
+}
+
+func (o *ObjHash) Get(key Hashable) (Object, bool) {
+	pair, ok := o.Pairs[key.HashKey()]
+	return pair.Value, ok
+}
+
+func (o *ObjHash) Set(key Hashable, value Object) {
+	hashKey := key.HashKey()
+	if _, ok := o.Pairs[hashKey]; !ok {
+		o.Keys = append(o.Keys, hashKey)
+	}
+	o.Pairs[hashKey] = HashPair{Key: key, Value: value}
+}
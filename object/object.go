@@ -3,6 +3,9 @@ package object
 import (
 	"fmt"
 	"monkey/ast"
+	"monkey/token"
+	"regexp"
+	"strings"
 )
 
 type ObjectType uint
@@ -16,6 +19,68 @@ const (
 	ObjTypeString
 	ObjTypeIdent
 	ObjTypeFunc
+	ObjTypeArray
+	ObjTypeHash
+	ObjTypeBuiltin
+	ObjTypeModule
+	ObjTypeStructType
+	ObjTypeStruct
+	ObjTypeEnum
+	ObjTypeBoundMethod
+	ObjTypeGenerator
+	ObjTypeBreak
+	ObjTypeContinue
+	ObjTypeChan
+	ObjTypeTask
+	ObjTypeQuote
+	ObjTypeMacro
+	ObjTypeRegex
+)
+
+var typeNames = map[ObjectType]string{
+	ObjTypeError:       "error",
+	ObjTypeNull:        "null",
+	ObjTypeReturn:      "return",
+	ObjTypeInt:         "int",
+	ObjTypeBool:        "bool",
+	ObjTypeString:      "string",
+	ObjTypeIdent:       "ident",
+	ObjTypeFunc:        "function",
+	ObjTypeArray:       "array",
+	ObjTypeHash:        "hash",
+	ObjTypeBuiltin:     "builtin",
+	ObjTypeModule:      "module",
+	ObjTypeStructType:  "type",
+	ObjTypeStruct:      "struct",
+	ObjTypeEnum:        "enum",
+	ObjTypeBoundMethod: "method",
+	ObjTypeGenerator:   "generator",
+	ObjTypeBreak:       "break",
+	ObjTypeContinue:    "continue",
+	ObjTypeChan:        "chan",
+	ObjTypeTask:        "task",
+	ObjTypeQuote:       "quote",
+	ObjTypeMacro:       "macro",
+	ObjTypeRegex:       "regex",
+}
+
+func (t ObjectType) String() string {
+	return typeNames[t]
+}
+
+const (
+	Error           = "Error"
+	ArgumentError   = "ArgumentError"
+	ArithmeticError = "ArithmeticError"
+	ChannelError    = "ChannelError"
+	DeadlockError   = "DeadlockError"
+	GeneratorExit   = "GeneratorExit"
+	ConstError      = "ConstError"
+	ImportError     = "ImportError"
+	MatchError      = "MatchError"
+	NameError       = "NameError"
+	RecursionError  = "RecursionError"
+	TypeError       = "TypeError"
 )
 
 type Object interface {
@@ -24,21 +89,96 @@ type Object interface {
 }
 
 type (
-	ObjError  struct{ Error string }
+	ObjError struct {
+		Error string
+		Kind  string
+		Pos   *token.Token
+		Value Object // Set when thrown by the script.
+		Stack []string
+	}
 	ObjNull   struct{}
 	ObjReturn struct{ Value Object }
 	ObjInt    struct{ Value int64 }
 	ObjBool   struct{ Value bool }
 	ObjString struct{ Value string }
 	ObjFunc   struct {
+		Name      string
+		Args      []ast.Pattern
+		Body      *ast.BlockStmt
+		Env       *Env
+		Generator bool
+		Doc       string
+	}
+	ObjGenerator struct {
+		Name string
+		// Next resumes the generator, returning false once it is exhausted.
+		Next func() (Object, bool)
+		// Close unwinds a suspended generator, running its defers.
+		Close func() *ObjError
+	}
+	ObjBreak    struct{}
+	ObjContinue struct{}
+	ObjBuiltin  struct {
+		Name string
+		Fn   func(args ...Object) Object
+	}
+	ObjModule struct {
+		Name string
+		// Shared with the module's scope, so reassignments are seen.
+		Exports map[string]*Binding
+	}
+	ObjStructType struct {
+		Name    string
+		Fields  []string
+		Methods map[string]*ObjFunc // Shared by all variants of an enum.
+		Enum    *ObjEnum            // Set for enum variants.
+	}
+	ObjStruct struct {
+		StructType *ObjStructType
+		Values     []Object // In the order of StructType.Fields.
+	}
+	ObjEnum struct {
+		Name     string
+		Variants []*ObjStructType
+		Methods  map[string]*ObjFunc
+	}
+	ObjBoundMethod struct {
+		Self Object
+		Func *ObjFunc
+	}
+	ObjQuote struct{ Node ast.Node }
+	ObjMacro struct {
 		Args []*ast.IdentExpr
 		Body *ast.BlockStmt
 		Env  *Env
 	}
+	ObjRegex struct{ Value *regexp.Regexp }
+	ObjArray struct{ Elems []Object }
+	ObjHash  struct {
+		Pairs map[HashKey]HashPair
+		Keys  []HashKey
+	}
 )
 
 func (o *ObjError) Type() ObjectType { return ObjTypeError }
 func (o *ObjError) String() string   { return fmt.Sprintf("<Error: %s>", o.Error) }
+func (o *ObjError) Trace() string {
+	var out strings.Builder
+	out.WriteString(o.String())
+	for i := 0; i < len(o.Stack); {
+		// Recursion repeats frames, which are shown once.
+		n := 1
+		for i+n < len(o.Stack) && o.Stack[i+n] == o.Stack[i] {
+			n++
+		}
+		out.WriteString("\n    in " + o.Stack[i])
+		if n > 1 {
+			fmt.Fprintf(&out, " (%d times)", n)
+		}
+		i += n
+	}
+	return out.String()
+}
 
 func (o *ObjNull) Type() ObjectType { return ObjTypeNull }
 func (o *ObjNull) String() string   { return "null" }
@@ -56,4 +196,109 @@ func (o *ObjString) Type() ObjectType { return ObjTypeString }
 func (o *ObjString) String() string   { return fmt.Sprintf("\"%s\"", o.Value) }
 
 func (o *ObjFunc) Type() ObjectType { return ObjTypeFunc }
-func (o *ObjFunc) String() string   { return "<function>" }
+func (o *ObjFunc) String() string {
+	if o.Name == "" {
+		return "<function>"
+	}
+	return fmt.Sprintf("<function %s>", o.Name)
+}
+
+func (o *ObjBuiltin) Type() ObjectType { return ObjTypeBuiltin }
+func (o *ObjBuiltin) String() string   { return fmt.Sprintf("<builtin %s>", o.Name) }
+
+func (o *ObjModule) Type() ObjectType { return ObjTypeModule }
+func (o *ObjModule) String() string   { return fmt.Sprintf("<module %s>", o.Name) }
+
+func (o *ObjStructType) Type() ObjectType { return ObjTypeStructType }
+func (o *ObjStructType) String() string {
+	if o.Enum != nil {
+		return fmt.Sprintf("<variant %s>", o.Name)
+	}
+	return fmt.Sprintf("<struct %s>", o.Name)
+}
+
+func (o *ObjStruct) Type() ObjectType { return ObjTypeStruct }
+func (o *ObjStruct) String() string {
+	if o.StructType.Enum != nil && len(o.Values) == 0 {
+		return o.StructType.Name
+	}
+	fields := make([]string, len(o.Values))
+	for i, val := range o.Values {
+		fields[i] = o.StructType.Fields[i] + ": " + val.String()
+	}
+	return o.StructType.Name + "{" + strings.Join(fields, ", ") + "}"
+}
+
+// TypeName is the name of the struct, or of the enum for a variant.
+func (o *ObjStruct) TypeName() string {
+	if o.StructType.Enum != nil {
+		return o.StructType.Enum.Name
+	}
+	return o.StructType.Name
+}
+
+func (o *ObjStruct) Field(name string) (Object, bool) {
+	for i, field := range o.StructType.Fields {
+		if field == name {
+			return o.Values[i], true
+		}
+	}
+	return nil, false
+}
+
+func (o *ObjEnum) Type() ObjectType { return ObjTypeEnum }
+func (o *ObjEnum) String() string   { return fmt.Sprintf("<enum %s>", o.Name) }
+
+func (o *ObjEnum) Variant(name string) (*ObjStructType, bool) {
+	for _, variant := range o.Variants {
+		if variant.Name == o.Name+"."+name {
+			return variant, true
+		}
+	}
+	return nil, false
+}
+
+func (o *ObjBoundMethod) Type() ObjectType { return ObjTypeBoundMethod }
+func (o *ObjBoundMethod) String() string   { return fmt.Sprintf("<method %s>", o.Func.Name) }
+
+func (o *ObjGenerator) Type() ObjectType { return ObjTypeGenerator }
+func (o *ObjGenerator) String() string {
+	if o.Name == "" {
+		return "<generator>"
+	}
+	return fmt.Sprintf("<generator %s>", o.Name)
+}
+
+func (o *ObjBreak) Type() ObjectType { return ObjTypeBreak }
+func (o *ObjBreak) String() string   { return "break" }
+
+func (o *ObjContinue) Type() ObjectType { return ObjTypeContinue }
+func (o *ObjContinue) String() string   { return "continue" }
+
+func (o *ObjQuote) Type() ObjectType { return ObjTypeQuote }
+func (o *ObjQuote) String() string   { return "quote(" + o.Node.String() + ")" }
+
+func (o *ObjMacro) Type() ObjectType { return ObjTypeMacro }
+func (o *ObjMacro) String() string   { return "<macro>" }
+
+func (o *ObjRegex) Type() ObjectType { return ObjTypeRegex }
+func (o *ObjRegex) String() string   { return `re"` + o.Value.String() + `"` }
+
+func (o *ObjArray) Type() ObjectType { return ObjTypeArray }
+func (o *ObjArray) String() string {
+	elems := make([]string, len(o.Elems))
+	for i, elem := range o.Elems {
+		elems[i] = elem.String()
+	}
+	return "[" + strings.Join(elems, ", ") + "]"
+}
+
+func (o *ObjHash) Type() ObjectType { return ObjTypeHash }
+func (o *ObjHash) String() string {
+	pairs := make([]string, len(o.Keys))
+	for i, key := range o.Keys {
+		pair := o.Pairs[key]
+		pairs[i] = pair.Key.String() + ": " + pair.Value.String()
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
@@ -3,37 +3,47 @@ package parser
 import (
 	"monkey/ast"
 	"monkey/token"
+	"regexp"
 	"strconv"
 )
 
 const (
 	_ int = iota
 	precLowest
-	precEquals
-	precCmp
+	precAssign
+	precCoalesce
 	precOr
 	precAnd
+	precEquals
+	precCmp
 	precSum
 	precProduct
 	precPrefix
 	precCall
+	precIndex
+	precMember
 )
 
 var infixPrecedences = map[token.TokenType]int{
-	token.Eq:     precEquals,
-	token.Neq:    precEquals,
-	token.Lt:     precCmp,
-	token.Gt:     precCmp,
-	token.Le:     precCmp,
-	token.Ge:     precCmp,
-	token.Or:     precOr,
-	token.And:    precAnd,
-	token.Plus:   precSum,
-	token.Minus:  precSum,
-	token.Star:   precProduct,
-	token.Slash:  precProduct,
-	token.Modulo: precProduct,
-	token.LParen: precCall,
+	token.Assign:   precAssign,
+	token.Eq:       precEquals,
+	token.Neq:      precEquals,
+	token.Lt:       precCmp,
+	token.Gt:       precCmp,
+	token.Le:       precCmp,
+	token.Ge:       precCmp,
+	token.Coalesce: precCoalesce,
+	token.Or:       precOr,
+	token.And:      precAnd,
+	token.Plus:     precSum,
+	token.Minus:    precSum,
+	token.Star:     precProduct,
+	token.Slash:    precProduct,
+	token.Modulo:   precProduct,
+	token.LParen:   precCall,
+	token.LBracket: precIndex,
+	token.Dot:      precMember,
+	token.OptChain: precMember,
 }
 
 func (p *Parser) parseExpr(prec int) ast.Expr {
@@ -46,6 +56,11 @@ func (p *Parser) parseExpr(prec int) ast.Expr {
 	}
 	left := prefix()
 	for {
+		if p.peek.Type == token.LBrace && prec < precCall && !p.noStructLit && isTypeName(left) {
+			p.next()
+			left = p.parseStructLiteralExpr(left)
+			continue
+		}
 		if peek, _ := infixPrecedences[p.peek.Type]; prec >= peek {
 			break
 		}
@@ -53,6 +68,14 @@ func (p *Parser) parseExpr(prec int) ast.Expr {
 		switch p.cur.Type {
 		case token.LParen:
 			left = p.parseFuncCallExpr(left)
+		case token.LBracket:
+			left = p.parseIndexExpr(left)
+		case token.Dot:
+			left = p.parseMemberExpr(left)
+		case token.OptChain:
+			left = p.parseOptChain(left)
+		case token.Assign:
+			left = p.parseAssignExpr(left)
 		default:
 			left = p.parseInfixExpr(left)
 		}
@@ -61,7 +84,12 @@ func (p *Parser) parseExpr(prec int) ast.Expr {
 }
 
 func (p *Parser) parseIdentExpr() ast.Expr {
-	return &ast.IdentExpr{Token: p.cur, Value: p.cur.Literal}
+	ident := &ast.IdentExpr{Token: p.cur, Value: p.cur.Literal}
+	if p.peek.Type == token.FatArrow && !p.inGuard {
+		p.next()
+		return p.parseLambdaBody(ident.Token, []ast.Pattern{ident})
+	}
+	return ident
 }
 
 func (p *Parser) parseIntLiteralExpr() ast.Expr {
@@ -83,6 +111,28 @@ func (p *Parser) parseStringExpr() ast.Expr {
 	return expr
 }
 
+func (p *Parser) parseNullExpr() ast.Expr {
+	return &ast.NullExpr{Token: p.cur}
+}
+
+func (p *Parser) parseRegexExpr() ast.Expr {
+	expr := &ast.RegexExpr{Token: p.cur}
+	if !p.expect(token.DQuote, "regex") {
+		return nil
+	}
+	pattern, ok := p.parseStringExpr().(*ast.StringExpr)
+	if !ok {
+		return nil
+	}
+	re, err := regexp.Compile(pattern.Value)
+	if err != nil {
+		p.errorf("Invalid regex %q: %s", pattern.Value, err)
+		return nil
+	}
+	expr.Regexp = re
+	return expr
+}
+
 func (p *Parser) parseBoolExpr() ast.Expr {
 	return &ast.BoolExpr{Token: p.cur, Value: p.cur.Literal == "true"}
 }
@@ -99,7 +149,7 @@ func (p *Parser) parseIncDecExpr() ast.Expr {
 	if !p.expect(token.Ident, "inc-dec stmt") {
 		return nil
 	}
-	expr.Ident = *p.parseIdentExpr().(*ast.IdentExpr)
+	expr.Ident = ast.IdentExpr{Token: p.cur, Value: p.cur.Literal}
 	return expr
 }
 
@@ -115,50 +165,152 @@ func (p *Parser) parseInfixExpr(left ast.Expr) ast.Expr {
 	return expr
 }
 
-func (p *Parser) parseGroupedExpr() ast.Expr {
+func (p *Parser) parseAssignExpr(left ast.Expr) ast.Expr {
+	name, ok := left.(*ast.IdentExpr)
+	if !ok {
+		p.errorf("Cannot assign to %s", left)
+		return nil
+	}
+	expr := &ast.AssignExpr{Token: p.cur, Name: name}
 	p.next()
-	expr := p.parseExpr(precLowest)
+	expr.Value = p.parseExpr(precAssign - 1)
+	return expr
+}
+
+func (p *Parser) parseGroupedExpr() ast.Expr {
+	tok, inGuard, noStructLit := p.cur, p.inGuard, p.noStructLit
+	if p.accept(token.RParen) {
+		if !p.expect(token.FatArrow, "lambda expr") {
+			return nil
+		}
+		return p.parseLambdaBody(tok, []ast.Pattern{})
+	}
+	p.inGuard, p.noStructLit = false, false
+	exprs := make([]ast.Expr, 0, 1)
+	for {
+		p.next()
+		exprs = append(exprs, p.parseExpr(precLowest))
+		if !p.accept(token.Comma) {
+			break
+		}
+	}
+	p.inGuard, p.noStructLit = inGuard, noStructLit
 	if !p.expect(token.RParen, "grouped expr") {
 		return nil
 	}
-	return expr
+	if len(exprs) == 1 && (p.peek.Type != token.FatArrow || inGuard) {
+		return exprs[0]
+	}
+
+	params := make([]ast.Pattern, len(exprs))
+	for i, expr := range exprs {
+		ident, ok := expr.(*ast.IdentExpr)
+		if !ok {
+			p.errorf("While parsing lambda expr: Expected parameter name, got %q", expr)
+			return nil
+		}
+		params[i] = ident
+	}
+	if !p.expect(token.FatArrow, "lambda expr") {
+		return nil
+	}
+	return p.parseLambdaBody(tok, params)
+}
+
+func (p *Parser) parsePipeLambdaExpr() ast.Expr {
+	tok := p.cur
+	params := make([]ast.Pattern, 0)
+	if tok.Type == token.Pipe && !p.parseList(token.Pipe, "lambda expr", func() bool {
+		param := p.parsePattern()
+		params = append(params, param)
+		return param != nil
+	}) {
+		return nil
+	}
+	return p.parseLambdaBody(tok, params)
+}
+
+func (p *Parser) parseLambdaBody(tok *token.Token, params []ast.Pattern) ast.Expr {
+	p.next()
+	restore := p.enterFunc()
+	defer restore()
+	ret := &ast.ReturnStmt{
+		Token: &token.Token{Type: token.Return, Literal: "return", Row: p.cur.Row, Col: p.cur.Col},
+		Value: p.parseExpr(precLowest),
+	}
+	if ret.Value == nil {
+		return nil
+	}
+	var stmt ast.Stmt = ret
+	return &ast.FuncExpr{
+		Token:     tok,
+		Args:      params,
+		Generator: p.generator,
+		BlockStmt: &ast.BlockStmt{Token: tok, Stmts: []*ast.Stmt{&stmt}},
+	}
 }
 
 func (p *Parser) parseFuncExpr() ast.Expr {
 	funcExpr := &ast.FuncExpr{
 		Token: p.cur,
-		Args:  make([]*ast.IdentExpr, 0),
+		Args:  make([]ast.Pattern, 0),
 	}
 	if !p.expect(token.LParen, "function expr") {
 		return nil
 	}
-	for p.next(); p.cur.Type != token.RParen; p.next() {
-		switch p.cur.Type {
-		case token.Ident:
-			ident, _ := p.parseIdentExpr().(*ast.IdentExpr)
-			funcExpr.Args = append(funcExpr.Args, ident)
-		case token.Comma:
-			break
-		default:
-			p.errorf(
-				"While parsing function arguments: Expected expression or comma, got %q %q",
-				p.cur.Type.String(),
-				p.cur.Literal,
-			)
+	if !p.parseList(token.RParen, "function expr", func() bool {
+		arg := p.parseTypedPattern()
+		funcExpr.Args = append(funcExpr.Args, arg)
+		return arg != nil
+	}) {
+		return nil
+	}
+	if p.accept(token.Arrow) {
+		p.next()
+		if funcExpr.Return = p.parseType(); funcExpr.Return == nil {
 			return nil
 		}
 	}
 	if !p.expect(token.LBrace, "function expr") {
 		return nil
 	}
+	restore := p.enterFunc()
 	funcExpr.BlockStmt = p.parseBlockStmt()
+	funcExpr.Generator = p.generator
+	restore()
 	return funcExpr
 }
 
+func (p *Parser) parseMacroExpr() ast.Expr {
+	macroExpr := &ast.MacroExpr{Token: p.cur, Args: []*ast.IdentExpr{}}
+	if !p.expect(token.LParen, "macro expr") {
+		return nil
+	}
+	if !p.parseList(token.RParen, "macro expr", func() bool {
+		if p.cur.Type != token.Ident {
+			p.errorf("While parsing macro expr: Expected parameter name, got `%s`", p.cur.Type.String())
+			return false
+		}
+		macroExpr.Args = append(macroExpr.Args, &ast.IdentExpr{Token: p.cur, Value: p.cur.Literal})
+		return true
+	}) {
+		return nil
+	}
+	if !p.expect(token.LBrace, "macro expr") {
+		return nil
+	}
+	restore := p.enterFunc()
+	macroExpr.Body = p.parseBlockStmt()
+	restore()
+	return macroExpr
+}
+
 func (p *Parser) parseIfExpr() ast.Expr {
 	ifExpr := &ast.IfExpr{Token: p.cur}
 	p.next()
+	p.noStructLit = true
 	ifExpr.Cond = p.parseExpr(precLowest)
+	p.noStructLit = false
 	p.next()
 	ifExpr.Then = p.parseStmt()
 	if p.accept(token.Else) {
@@ -168,22 +320,355 @@ func (p *Parser) parseIfExpr() ast.Expr {
 	return ifExpr
 }
 
+func (p *Parser) parseTryExpr() ast.Expr {
+	tryExpr := &ast.TryExpr{Token: p.cur}
+	if !p.expect(token.LBrace, "try expr") {
+		return nil
+	}
+	tryExpr.Body = p.parseBlockStmt()
+	if p.accept(token.Catch) {
+		if p.accept(token.LParen) {
+			p.next()
+			if tryExpr.Param = p.parsePattern(); tryExpr.Param == nil || !p.expect(token.RParen, "catch clause") {
+				return nil
+			}
+		}
+		if !p.expect(token.LBrace, "catch clause") {
+			return nil
+		}
+		tryExpr.Catch = p.parseBlockStmt()
+	}
+	if p.accept(token.Finally) {
+		if !p.expect(token.LBrace, "finally clause") {
+			return nil
+		}
+		tryExpr.Finally = p.parseBlockStmt()
+	}
+	if tryExpr.Catch == nil && tryExpr.Finally == nil {
+		p.errorf("While parsing try expr: Expected catch or finally clause")
+		return nil
+	}
+	return tryExpr
+}
+
+func (p *Parser) parseSpawnExpr() ast.Expr {
+	spawnExpr := &ast.SpawnExpr{Token: p.cur}
+	p.next()
+	call, ok := p.parseExpr(precLowest).(*ast.FuncCallExpr)
+	if !ok {
+		p.errorf("While parsing spawn expr: Expected a function call")
+		return nil
+	}
+	spawnExpr.Call = call
+	return spawnExpr
+}
+
+func (p *Parser) parseSelectExpr() ast.Expr {
+	selectExpr := &ast.SelectExpr{Token: p.cur}
+	if !p.expect(token.LBrace, "select expr") {
+		return nil
+	}
+	for !p.accept(token.RBrace) {
+		p.next()
+		c := &ast.SelectCase{}
+		if p.cur.Type != token.Ident || p.cur.Literal != "_" || p.peek.Type != token.FatArrow {
+			p.inGuard = true
+			op, _ := p.parseExpr(precLowest).(*ast.FuncCallExpr)
+			p.inGuard = false
+			if op == nil || !isChanOp(op) {
+				p.errorf("While parsing select expr: Expected ch.send(x) or ch.recv()")
+				return nil
+			}
+			c.Op = op
+			if p.accept(token.As) {
+				if op.Func.(*ast.MemberExpr).Member.Value != "recv" {
+					p.errorf("While parsing select expr: Only a recv can be bound with as")
+					return nil
+				}
+				p.next()
+				if c.Binding = p.parsePattern(); c.Binding == nil {
+					return nil
+				}
+			}
+		}
+		if !p.expect(token.FatArrow, "select expr") {
+			return nil
+		}
+		p.next()
+		if c.Body = p.parseStmt(); c.Body == nil {
+			p.errorf("While parsing select expr: Expected case body")
+			return nil
+		}
+		selectExpr.Cases = append(selectExpr.Cases, c)
+		if p.peek.Type != token.RBrace && !p.accept(token.Semicolon) && !p.expect(token.Comma, "select expr") {
+			return nil
+		}
+	}
+	return selectExpr
+}
+
+func isChanOp(call *ast.FuncCallExpr) bool {
+	member, ok := call.Func.(*ast.MemberExpr)
+	if !ok || len(call.KwArgs) > 0 {
+		return false
+	}
+	switch member.Member.Value {
+	case "send":
+		return len(call.Args) == 1
+	case "recv":
+		return len(call.Args) == 0
+	default:
+		return false
+	}
+}
+
+func (p *Parser) parseMatchExpr() ast.Expr {
+	matchExpr := &ast.MatchExpr{Token: p.cur}
+	p.next()
+	p.noStructLit = true
+	matchExpr.Subject = p.parseExpr(precLowest)
+	p.noStructLit = false
+	if !p.expect(token.LBrace, "match expr") {
+		return nil
+	}
+	for !p.accept(token.RBrace) {
+		p.next()
+		arm := &ast.MatchArm{Pattern: p.parsePattern()}
+		if arm.Pattern == nil {
+			return nil
+		}
+		if p.accept(token.If) {
+			p.next()
+			p.inGuard = true
+			arm.Guard = p.parseExpr(precLowest)
+			p.inGuard = false
+		}
+		if !p.expect(token.FatArrow, "match expr") {
+			return nil
+		}
+		p.next()
+		if arm.Body = p.parseStmt(); arm.Body == nil {
+			p.errorf("While parsing match expr: Expected arm body")
+			return nil
+		}
+		matchExpr.Arms = append(matchExpr.Arms, arm)
+		// Arms ending in a block are usually followed by a newline, not a comma.
+		if p.peek.Type != token.RBrace && !p.accept(token.Semicolon) && !p.expect(token.Comma, "match expr") {
+			return nil
+		}
+	}
+	return matchExpr
+}
+
 func (p *Parser) parseFuncCallExpr(f ast.Expr) ast.Expr {
 	callExpr := &ast.FuncCallExpr{
 		Token: p.cur,
 		Func:  f,
 	}
-	if p.accept(token.RParen) {
-		return callExpr
+	inGuard, noStructLit := p.inGuard, p.noStructLit
+	p.inGuard, p.noStructLit = false, false
+	defer func() { p.inGuard, p.noStructLit = inGuard, noStructLit }()
+	if !p.parseList(token.RParen, "func call expr", func() bool {
+		if p.cur.Type == token.Ident && p.peek.Type == token.Colon {
+			kwarg := &ast.KeywordArg{Name: &ast.IdentExpr{Token: p.cur, Value: p.cur.Literal}}
+			p.next()
+			p.next()
+			kwarg.Value = p.parseExpr(precLowest)
+			callExpr.KwArgs = append(callExpr.KwArgs, kwarg)
+			return kwarg.Value != nil
+		}
+		if len(callExpr.KwArgs) > 0 {
+			p.errorf("While parsing func call expr: Positional argument after keyword argument")
+			return false
+		}
+		arg := p.parseExpr(precLowest)
+		callExpr.Args = append(callExpr.Args, arg)
+		return arg != nil
+	}) {
+		return nil
+	}
+	return callExpr
+}
+
+func (p *Parser) parseArrayExpr() ast.Expr {
+	arrayExpr := &ast.ArrayExpr{Token: p.cur}
+	var comp ast.Expr
+	if !p.parseList(token.RBracket, "array expr", func() bool {
+		elem := p.parseExpr(precLowest)
+		if elem != nil && len(arrayExpr.Elems) == 0 && p.peek.Type == token.For {
+			// The comprehension parses the rest of the brackets.
+			comp = p.parseComprehensionExpr(arrayExpr.Token, nil, elem, token.RBracket)
+			return false
+		}
+		arrayExpr.Elems = append(arrayExpr.Elems, elem)
+		return elem != nil
+	}) {
+		return comp
 	}
+	return arrayExpr
+}
+
+func (p *Parser) parseHashExpr() ast.Expr {
+	hashExpr := &ast.HashExpr{Token: p.cur}
+	var comp ast.Expr
+	if !p.parseList(token.RBrace, "hash expr", func() bool {
+		pair := &ast.HashPair{Key: p.parseExpr(precLowest)}
+		if pair.Key == nil || !p.expect(token.Colon, "hash expr") {
+			return false
+		}
+		p.next()
+		pair.Value = p.parseExpr(precLowest)
+		if pair.Value != nil && len(hashExpr.Pairs) == 0 && p.peek.Type == token.For {
+			comp = p.parseComprehensionExpr(hashExpr.Token, pair.Key, pair.Value, token.RBrace)
+			return false
+		}
+		hashExpr.Pairs = append(hashExpr.Pairs, pair)
+		return pair.Value != nil
+	}) {
+		return comp
+	}
+	return hashExpr
+}
+
+// parseComprehensionExpr parses the `for vars in iterable if cond` clause and
+// closing bracket of a comprehension.
+func (p *Parser) parseComprehensionExpr(tok *token.Token, key, value ast.Expr, end token.TokenType) ast.Expr {
+	comp := &ast.ComprehensionExpr{Token: tok, Key: key, Value: value}
 	p.next()
-	callExpr.Args = append(callExpr.Args, p.parseExpr(precLowest))
-	for p.accept(token.Comma) {
+	for p.next(); ; p.next() {
+		v := p.parsePattern()
+		if v == nil {
+			return nil
+		}
+		comp.Vars = append(comp.Vars, v)
+		if len(comp.Vars) == 2 || !p.accept(token.Comma) {
+			break
+		}
+	}
+	if !p.expect(token.In, "comprehension") {
+		return nil
+	}
+	p.next()
+	if comp.Iterable = p.parseExpr(precLowest); comp.Iterable == nil {
+		return nil
+	}
+	if p.accept(token.If) {
 		p.next()
-		callExpr.Args = append(callExpr.Args, p.parseExpr(precLowest))
+		if comp.Cond = p.parseExpr(precLowest); comp.Cond == nil {
+			return nil
+		}
 	}
-	if !p.expect(token.RParen, "func call expr") {
+	if !p.expect(end, "comprehension") {
 		return nil
 	}
-	return callExpr
+	return comp
+}
+
+func isTypeName(expr ast.Expr) bool {
+	switch expr := expr.(type) {
+	case *ast.IdentExpr:
+		return true
+	case *ast.MemberExpr:
+		return isTypeName(expr.Object)
+	default:
+		return false
+	}
+}
+
+func (p *Parser) parseStructLiteralExpr(typ ast.Expr) ast.Expr {
+	structExpr := &ast.StructLiteralExpr{Token: p.cur, Type: typ}
+	if !p.parseList(token.RBrace, "struct literal", func() bool {
+		if p.cur.Type != token.Ident {
+			p.errorf("While parsing struct literal: Expected field name, got `%s`", p.cur.Type.String())
+			return false
+		}
+		field := &ast.KeywordArg{Name: &ast.IdentExpr{Token: p.cur, Value: p.cur.Literal}}
+		field.Value = field.Name
+		if p.accept(token.Colon) {
+			p.next()
+			field.Value = p.parseExpr(precLowest)
+		}
+		structExpr.Fields = append(structExpr.Fields, field)
+		return field.Value != nil
+	}) {
+		return nil
+	}
+	return structExpr
+}
+
+func (p *Parser) parseIndexExpr(left ast.Expr) ast.Expr {
+	indexExpr := &ast.IndexExpr{Token: p.cur, Left: left}
+	if p.peek.Type != token.Colon {
+		p.next()
+		indexExpr.Index = p.parseExpr(precLowest)
+	}
+	if p.peek.Type == token.Colon {
+		return p.parseSliceExpr(indexExpr)
+	}
+	if !p.expect(token.RBracket, "index expr") {
+		return nil
+	}
+	return indexExpr
+}
+
+// parseSliceExpr parses the rest of `left[start:end:step]`, where every bound
+// is optional.
+func (p *Parser) parseSliceExpr(index *ast.IndexExpr) ast.Expr {
+	sliceExpr := &ast.SliceExpr{Token: index.Token, Left: index.Left, Start: index.Index}
+	p.next()
+	sliceExpr.End = p.parseSliceBound()
+	if p.accept(token.Colon) {
+		sliceExpr.Step = p.parseSliceBound()
+	}
+	if !p.expect(token.RBracket, "slice expr") {
+		return nil
+	}
+	return sliceExpr
+}
+
+func (p *Parser) parseSliceBound() ast.Expr {
+	if p.peek.Type == token.Colon || p.peek.Type == token.RBracket {
+		return nil
+	}
+	p.next()
+	return p.parseExpr(precLowest)
+}
+
+// parseOptChain parses `a?.b`, `a?.[i]` and `f?.(args)`.
+func (p *Parser) parseOptChain(left ast.Expr) ast.Expr {
+	switch p.peek.Type {
+	case token.Ident:
+		if member, ok := p.parseMemberExpr(left).(*ast.MemberExpr); ok {
+			member.Optional = true
+			return member
+		}
+	case token.LBracket:
+		p.next()
+		switch index := p.parseIndexExpr(left).(type) {
+		case *ast.IndexExpr:
+			index.Optional = true
+			return index
+		case *ast.SliceExpr:
+			index.Optional = true
+			return index
+		}
+	case token.LParen:
+		p.next()
+		if call, ok := p.parseFuncCallExpr(left).(*ast.FuncCallExpr); ok {
+			call.Optional = true
+			return call
+		}
+	default:
+		p.errorf("While parsing optional chain: Expected a member, `[` or `(`, got `%s`", p.peek.Type.String())
+	}
+	return nil
+}
+
+func (p *Parser) parseMemberExpr(left ast.Expr) ast.Expr {
+	memberExpr := &ast.MemberExpr{Token: p.cur, Object: left}
+	if !p.expect(token.Ident, "member expr") {
+		return nil
+	}
+	memberExpr.Member = &ast.IdentExpr{Token: p.cur, Value: p.cur.Literal}
+	return memberExpr
 }
@@ -13,6 +13,12 @@ type Parser struct {
 	cur, peek      *token.Token
 	Errors         []ParserError
 	prefixParseFns map[token.TokenType]func() ast.Expr
+	inGuard        bool
+	// Set in if and match headers, where `x {` starts the body, as in Go.
+	noStructLit bool
+	// State of the innermost function being parsed.
+	inFunc, generator bool
+	loops             int
 }
 
 type ParserError struct {
@@ -35,6 +41,7 @@ func New(l *lexer.Lexer, ch <-chan *token.Token) *Parser {
 		token.Ident:     p.parseIdentExpr,
 		token.Int:       p.parseIntLiteralExpr,
 		token.DQuote:    p.parseStringExpr,
+		token.Regex:     p.parseRegexExpr,
 		token.Hash:      p.parsePrefixExpr,
 		token.Bang:      p.parsePrefixExpr,
 		token.Minus:     p.parsePrefixExpr,
@@ -43,12 +50,29 @@ func New(l *lexer.Lexer, ch <-chan *token.Token) *Parser {
 		token.True:      p.parseBoolExpr,
 		token.False:     p.parseBoolExpr,
 		token.LParen:    p.parseGroupedExpr,
+		token.LBracket:  p.parseArrayExpr,
+		token.LBrace:    p.parseHashExpr,
 		token.Function:  p.parseFuncExpr,
 		token.If:        p.parseIfExpr,
+		token.Match:     p.parseMatchExpr,
+		token.Try:       p.parseTryExpr,
+		token.Spawn:     p.parseSpawnExpr,
+		token.Macro:     p.parseMacroExpr,
+		token.Null:      p.parseNullExpr,
+		token.Select:    p.parseSelectExpr,
+		token.Pipe:      p.parsePipeLambdaExpr,
+		token.Or:        p.parsePipeLambdaExpr,
 	}
 	return p
 }
 
+// enterFunc resets the per-function state, returning a function restoring it.
+func (p *Parser) enterFunc() func() {
+	inFunc, generator, loops := p.inFunc, p.generator, p.loops
+	p.inFunc, p.generator, p.loops = true, false, 0
+	return func() { p.inFunc, p.generator, p.loops = inFunc, generator, loops }
+}
+
 func (p *Parser) next() {
 	p.cur, p.peek = p.peek, <-p.ch
 }
@@ -56,7 +80,7 @@ func (p *Parser) next() {
 func (p *Parser) Parse() *ast.Program {
 	prog := &ast.Program{}
 	for p.next(); p.cur.Type != token.EOF; p.next() {
-		if stmt := p.parseStmt(); stmt != nil {
+		if stmt := p.parseTopLevelStmt(); stmt != nil {
 			prog.Stmts = append(prog.Stmts, stmt)
 		}
 	}
@@ -84,6 +108,19 @@ func (p *Parser) expect(t token.TokenType, caller string) bool {
 	return false
 }
 
+func (p *Parser) parseList(end token.TokenType, caller string, parseElem func() bool) bool {
+	for !p.accept(end) {
+		p.next()
+		if !parseElem() {
+			return false
+		}
+		if p.peek.Type != end && !p.expect(token.Comma, caller) {
+			return false
+		}
+	}
+	return true
+}
+
 func (p *Parser) errorf(format string, a ...interface{}) {
 	p.Errors = append(
 		p.Errors,
@@ -87,7 +87,7 @@ func TestLetStmts(t *testing.T) {
 	for i, tt := range tests {
 		if letStmt, ok := program.Stmts[i].(*ast.LetStmt); !ok {
 			t.Errorf("Not return statement, got %T", program.Stmts[i])
-		} else if name := letStmt.Name.Value; name != tt.expectedIdent {
+		} else if name := letStmt.Name.String(); name != tt.expectedIdent {
 			t.Errorf("Expected name %s, got %s", tt.expectedIdent, name)
 		}
 	}
@@ -157,8 +157,8 @@ func TestIdentExpr(t *testing.T) {
 		if tt.shouldParse {
 			if letStmt, ok := program.Stmts[0].(*ast.LetStmt); !ok {
 				t.Fatalf("Failed to parse let stmt, got %T", program.Stmts[0])
-			} else if letStmt.Name.Value != tt.input {
-				t.Errorf("Token literal not %s, got %s", tt.input, letStmt.Name.Value)
+			} else if letStmt.Name.String() != tt.input {
+				t.Errorf("Token literal not %s, got %s", tt.input, letStmt.Name.String())
 			}
 		}
 	}
@@ -298,6 +298,23 @@ func TestInfixExpr(t *testing.T) {
 	}
 }
 
+func TestOperatorPrecedence(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		{"a < b && c > d", "((a<b)&&(c>d))"},
+		{"a == b || c != d && e", "((a==b)||((c!=d)&&e))"},
+		{"a + b * c > d", "((a+(b*c))>d)"},
+	}
+
+	for _, tt := range tests {
+		program := setup(t, tt.input)
+		if output := program.String(); output != tt.expected {
+			t.Errorf("Expected %q, got %q", tt.expected, output)
+		}
+	}
+}
+
 func TestFuncExpr(t *testing.T) {
 	input := `let void = fn() {  };
 	let square = fn(x) { return x*x; };
@@ -413,6 +430,621 @@ func TestFuncCallExpr(t *testing.T) {
 	}
 }
 
+func TestKeywordArgs(t *testing.T) {
+	input := `connect("a", port: 80, retries: 1+2)`
+	program := setup(t, input)
+
+	exprStmt, _ := program.Stmts[0].(*ast.ExprStmt)
+	funcCallExpr, ok := exprStmt.Expr.(*ast.FuncCallExpr)
+	if !ok {
+		t.Fatalf("Expected func call expr, got %T", exprStmt.Expr)
+	}
+	if len(funcCallExpr.Args) != 1 {
+		t.Errorf("Expected %d positional args, got %d", 1, len(funcCallExpr.Args))
+	}
+	tests := []struct {
+		name, value string
+	}{
+		{"port", "80"},
+		{"retries", "(1+2)"},
+	}
+	if len(funcCallExpr.KwArgs) != len(tests) {
+		t.Fatalf("Expected %d keyword args, got %d", len(tests), len(funcCallExpr.KwArgs))
+	}
+	for i, tt := range tests {
+		kwarg := funcCallExpr.KwArgs[i]
+		if kwarg.Name.Value != tt.name {
+			t.Errorf("Keyword arg %d: expected name %q, got %q", i, tt.name, kwarg.Name.Value)
+		}
+		if kwarg.Value.String() != tt.value {
+			t.Errorf("Keyword arg %d: expected value %q, got %q", i, tt.value, kwarg.Value.String())
+		}
+	}
+
+	ch := make(chan *token.Token)
+	p := New(lexer.New(`connect(port: 80, "a")`, ch), ch)
+	p.Parse()
+	if len(p.Errors) == 0 {
+		t.Errorf("Positional argument after keyword argument was allowed")
+	}
+}
+
+func TestArrayHashIndexExpr(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		{`[1, 2+3, "a"]`, `[1, (2+3), "a"]`},
+		{`[]`, `[]`},
+		{`let h = {"a": 1, 2: [3],};`, `let h = {"a": 1, 2: [3]};`},
+		{`xs[1+1]`, `(xs[(1+1)])`},
+		{`f(x)[0][1]`, `((f(x)[0])[1])`},
+	}
+
+	for _, tt := range tests {
+		program := setup(t, tt.input)
+		if len(program.Stmts) != 1 {
+			t.Fatalf("Expected 1 stmt, got %d", len(program.Stmts))
+		}
+		if output := program.Stmts[0].String(); output != tt.expected {
+			t.Errorf("Expected %q, got %q", tt.expected, output)
+		}
+	}
+}
+
+func TestPatterns(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		{`let [a, b, ...rest] = xs;`, `let [a, b, ...rest] = xs;`},
+		{`let {name, age: years} = person;`, `let {name, age: years} = person;`},
+		{`let {"full name": n, pos: [x, y]} = p;`, `let {full name: n, pos: [x, y]} = p;`},
+		{`let f = fn([a, b], {c}) { };`, `let f = fn([a, b], {c}) {};`},
+	}
+
+	for _, tt := range tests {
+		program := setup(t, tt.input)
+		if output := program.String(); output != tt.expected {
+			t.Errorf("Expected %q, got %q", tt.expected, output)
+		}
+	}
+
+	for _, input := range []string{`let [...a, b] = xs;`, `let [a + b] = xs;`, `let {1: a} = h;`} {
+		ch := make(chan *token.Token)
+		p := New(lexer.New(input, ch), ch)
+		p.Parse()
+		if len(p.Errors) == 0 {
+			t.Errorf("Invalid pattern was allowed: %q", input)
+		}
+	}
+}
+
+func TestMatchExpr(t *testing.T) {
+	input := `let kind = match (v) {
+		0 => "zero",
+		-1 => "minus one",
+		[x, y] => x,
+		{kind: "a"} => { let z = 1; z },
+		n if n > 10 => n,
+		_ => "other",
+	};`
+	program := setup(t, input)
+
+	letStmt, _ := program.Stmts[0].(*ast.LetStmt)
+	matchExpr, ok := letStmt.Value.(*ast.MatchExpr)
+	if !ok {
+		t.Fatalf("Expected match expr, got %T", letStmt.Value)
+	}
+	if matchExpr.Subject.String() != "v" {
+		t.Errorf("Expected subject %q, got %q", "v", matchExpr.Subject.String())
+	}
+	tests := []string{
+		`0 => "zero"`,
+		`-1 => "minus one"`,
+		`[x, y] => x`,
+		`{kind: "a"} => {let z = 1; z}`,
+		`n if (n>10) => n`,
+		`_ => "other"`,
+	}
+	if len(matchExpr.Arms) != len(tests) {
+		t.Fatalf("Expected %d arms, got %d", len(tests), len(matchExpr.Arms))
+	}
+	for i, tt := range tests {
+		if arm := matchExpr.Arms[i].String(); arm != tt {
+			t.Errorf("Arm %d: expected %q, got %q", i, tt, arm)
+		}
+	}
+}
+
+func TestLambdaExpr(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		{"x => x * 2", "fn(x) {return (x*2);}"},
+		{"(x, y) => x + y", "fn(x, y) {return (x+y);}"},
+		{"() => 1", "fn() {return 1;}"},
+		{"(x) => x", "fn(x) {return x;}"},
+		{"|x, [y, z]| x + y", "fn(x, [y, z]) {return (x+y);}"},
+		{"|| 1", "fn() {return 1;}"},
+		{"map(xs, x => x + 1, 2)", "map(xs, fn(x) {return (x+1);}, 2)"},
+		{"x => y => x + y", "fn(x) {return fn(y) {return (x+y);};}"},
+		{"(a + b) * c", "((a+b)*c)"},
+		{"match (v) { n if ok => n, n if (ok) => n, n if f(x => x) => n }", "match v {n if ok => n, n if ok => n, n if f(fn(x) {return x;}) => n}"},
+	}
+
+	for _, tt := range tests {
+		program := setup(t, tt.input)
+		if output := program.String(); output != tt.expected {
+			t.Errorf("Expected %q, got %q", tt.expected, output)
+		}
+	}
+
+	for _, input := range []string{"(a, b)", "(1, b) => b", "() + 1"} {
+		ch := make(chan *token.Token)
+		p := New(lexer.New(input, ch), ch)
+		p.Parse()
+		if len(p.Errors) == 0 {
+			t.Errorf("Invalid lambda was allowed: %q", input)
+		}
+	}
+}
+
+func TestMemberExpr(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		{"obj.field", "obj.field"},
+		{"a.b.c", "a.b.c"},
+		{"\"abc\".upper()", "\"abc\".upper()"},
+		{"xs[0].push(1)", "(xs[0]).push(1)"},
+		{"-a.b", "(-a.b)"},
+		{"a.b * c.d(e)", "(a.b*c.d(e))"},
+	}
+
+	for _, tt := range tests {
+		program := setup(t, tt.input)
+		if output := program.String(); output != tt.expected {
+			t.Errorf("Expected %q, got %q", tt.expected, output)
+		}
+	}
+}
+
+func TestSemicolonInsertion(t *testing.T) {
+	tests := []struct {
+		withNewlines, withSemicolons string
+	}{
+		{"let x = 1\nlet y = x\n", "let x = 1; let y = x;"},
+		{"let f = fn(x) {\n\treturn x\n}\nf(2)\n", "let f = fn(x) { return x; }; f(2);"},
+		{"return\nx\n", "return; x;"},
+		{"fn f() { let x = 1 }", "fn f() { let x = 1; }"},
+		{"if (a) { let [x, y] = b }", "if (a) { let [x, y] = b; }"},
+		{"let xs = [\n\t1,\n\t2,\n]\n", "let xs = [1, 2];"},
+		{"f(\n\ta: 1,\n)\n", "f(a: 1);"},
+		{"match (x) {\n\t0 => {\n\t\t1\n\t}\n\t_ => 2\n}\n", "match (x) { 0 => { 1 }, _ => 2 }"},
+	}
+
+	for _, tt := range tests {
+		expected := setup(t, tt.withSemicolons).String()
+		if output := setup(t, tt.withNewlines).String(); output != expected {
+			t.Errorf("Expected %q, got %q", expected, output)
+		}
+	}
+}
+
+func TestConstAndAssign(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		{"const x = 1;", "const x = 1;"},
+		{"const [a, b] = xs;", "const [a, b] = xs;"},
+		{"x = 1", "(x = 1)"},
+		{"x = y = a + 1", "(x = (y = (a+1)))"},
+	}
+
+	for _, tt := range tests {
+		program := setup(t, tt.input)
+		if output := program.String(); output != tt.expected {
+			t.Errorf("Expected %q, got %q", tt.expected, output)
+		}
+	}
+
+	ch := make(chan *token.Token)
+	p := New(lexer.New("a + b = 1", ch), ch)
+	p.Parse()
+	if len(p.Errors) == 0 {
+		t.Errorf("Assignment to non-identifier was allowed")
+	}
+}
+
+func TestFuncStmt(t *testing.T) {
+	input := `fn add(a, b) { return a + b; }
+	fn(x) { x }(1)`
+	program := setup(t, input)
+
+	if len(program.Stmts) != 2 {
+		t.Fatalf("Expected 2 stmts, got %d", len(program.Stmts))
+	}
+	funcStmt, ok := program.Stmts[0].(*ast.FuncStmt)
+	if !ok {
+		t.Fatalf("Expected func stmt, got %T", program.Stmts[0])
+	}
+	if funcStmt.Name.Value != "add" {
+		t.Errorf("Expected name %q, got %q", "add", funcStmt.Name.Value)
+	}
+	if len(funcStmt.Func.Args) != 2 {
+		t.Errorf("Expected %d args, got %d", 2, len(funcStmt.Func.Args))
+	}
+	if output := funcStmt.String(); output != "fn add(a, b) {return (a+b);}" {
+		t.Errorf("Unexpected func stmt string %q", output)
+	}
+	if _, ok := program.Stmts[1].(*ast.ExprStmt); !ok {
+		t.Errorf("Anonymous function should be an expr stmt, got %T", program.Stmts[1])
+	}
+}
+
+func TestDiscardedExprStmt(t *testing.T) {
+	input := `{ a; b }
+	{ a
+	b; }`
+	program := setup(t, input)
+
+	tests := [][]bool{{true, false}, {false, true}}
+	if len(program.Stmts) != len(tests) {
+		t.Fatalf("Expected %d stmts, got %d", len(tests), len(program.Stmts))
+	}
+	for i, tt := range tests {
+		block, _ := program.Stmts[i].(*ast.BlockStmt)
+		for j, discard := range tt {
+			if exprStmt := (*block.Stmts[j]).(*ast.ExprStmt); exprStmt.Discard != discard {
+				t.Errorf("Block %d, stmt %d: expected discard %t, got %t", i, j, discard, exprStmt.Discard)
+			}
+		}
+	}
+}
+
+func TestImportExport(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		{`import "lib/strings.monkey" as s;`, `import "lib/strings.monkey" as s;`},
+		{"import \"lib/strings\"\n", `import "lib/strings" as strings;`},
+		{"export let x = 1\n", "export let x = 1;"},
+		{"export fn f() { 1 }", "export fn f() {1}"},
+	}
+
+	for _, tt := range tests {
+		program := setup(t, tt.input)
+		if output := program.String(); output != tt.expected {
+			t.Errorf("Expected %q, got %q", tt.expected, output)
+		}
+	}
+
+	for _, input := range []string{`fn f() { import "a" }`, "{ export let x = 1 }", "export x"} {
+		ch := make(chan *token.Token)
+		p := New(lexer.New(input, ch), ch)
+		p.Parse()
+		if len(p.Errors) == 0 {
+			t.Errorf("%s: expected parse error", input)
+		}
+	}
+}
+
+func TestTryExpr(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		{"try { f() } catch (e) { g(e) }", "try {f()} catch (e) {g(e)}"},
+		{"try { f() } catch { 0 } finally { g() }", "try {f()} catch {0} finally {g()}"},
+		{"let x = try { f() } finally { g() }\n", "let x = try {f()} finally {g()};"},
+		{"try { throw {message: m} } catch ({message}) { message }", "try {throw {message: m};} catch ({message}) {message}"},
+		{"throw err\n", "throw err;"},
+	}
+
+	for _, tt := range tests {
+		program := setup(t, tt.input)
+		if output := program.String(); output != tt.expected {
+			t.Errorf("Expected %q, got %q", tt.expected, output)
+		}
+	}
+
+	for _, input := range []string{"try { f() }", "try { f() } catch (1 + 2) {}", "throw;"} {
+		ch := make(chan *token.Token)
+		p := New(lexer.New(input, ch), ch)
+		p.Parse()
+		if len(p.Errors) == 0 {
+			t.Errorf("%s: expected parse error", input)
+		}
+	}
+}
+
+func TestDeferStmt(t *testing.T) {
+	program := setup(t, "fn f() { defer close(file, force: true); defer log.flush() }")
+	expected := "fn f() {defer close(file, force: true); defer log.flush();}"
+	if output := program.String(); output != expected {
+		t.Errorf("Expected %q, got %q", expected, output)
+	}
+
+	ch := make(chan *token.Token)
+	p := New(lexer.New("fn f() { defer x + 1 }", ch), ch)
+	p.Parse()
+	if len(p.Errors) == 0 {
+		t.Errorf("defer of a non-call was allowed")
+	}
+}
+
+func TestStructs(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		{"struct Point { x, y }", "struct Point {x, y}"},
+		{"struct Point {\n\tx,\n\ty,\n}\n", "struct Point {x, y}"},
+		{"struct Point {\n\tx\n\ty\n\tfn norm(self) { self.x }\n}\n", "struct Point {x, y, fn norm(self) {self.x}}"},
+		{"Point{x: 1, y}", "Point{x: 1, y: y}"},
+		{"geo.Point{x: 1}.x", "geo.Point{x: 1}.x"},
+		{"if x { y }", "if x {y}"},
+		{"match p { _ => 1 }", "match p {_ => 1}"},
+		{"if (p == Point{x: 1}) { y }", "if (p==Point{x: 1}) {y}"},
+	}
+
+	for _, tt := range tests {
+		program := setup(t, tt.input)
+		if output := program.String(); output != tt.expected {
+			t.Errorf("Expected %q, got %q", tt.expected, output)
+		}
+	}
+
+	for _, input := range []string{"struct Point { x, x }", "struct Point { 1 }", "Point{1}"} {
+		ch := make(chan *token.Token)
+		p := New(lexer.New(input, ch), ch)
+		p.Parse()
+		if len(p.Errors) == 0 {
+			t.Errorf("%s: expected parse error", input)
+		}
+	}
+}
+
+func TestEnums(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		{"enum Shape { Circle(r), Rect(w, h), Empty }", "enum Shape {Circle(r), Rect(w, h), Empty}"},
+		{"enum State {\n\tIdle,\n\tRunning(pid),\n}\n", "enum State {Idle, Running(pid)}"},
+		{"enum State {\n\tIdle\n\tfn done(self) { false }\n}\n", "enum State {Idle, fn done(self) {false}}"},
+		{"match s { Shape.Circle(r) => r, geo.Shape.Empty => 0, Point(x, _) => x }", "match s {Shape.Circle(r) => r, geo.Shape.Empty => 0, Point(x, _) => x}"},
+	}
+
+	for _, tt := range tests {
+		program := setup(t, tt.input)
+		if output := program.String(); output != tt.expected {
+			t.Errorf("Expected %q, got %q", tt.expected, output)
+		}
+	}
+
+	for _, input := range []string{"enum Shape { Circle(r), Circle }", "enum Shape { Rect(w, w) }", "enum Shape { 1 }"} {
+		ch := make(chan *token.Token)
+		p := New(lexer.New(input, ch), ch)
+		p.Parse()
+		if len(p.Errors) == 0 {
+			t.Errorf("%s: expected parse error", input)
+		}
+	}
+}
+
+func TestLoopsAndGenerators(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		{"for (x in xs) { f(x) }", "for (x in xs) {f(x)}"},
+		{"for [k, v] in pairs {\n\tif (k) { continue }\n\tbreak\n}\n", "for ([k, v] in pairs) {if k {continue;} break;}"},
+		{"fn gen() {\n\tyield 1\n\tyield\n}", "fn gen() {yield 1; yield;}"},
+	}
+
+	for _, tt := range tests {
+		program := setup(t, tt.input)
+		if output := program.String(); output != tt.expected {
+			t.Errorf("Expected %q, got %q", tt.expected, output)
+		}
+	}
+
+	fn := setup(t, "fn f() { fn g() { yield 1 } }").Stmts[0].(*ast.FuncStmt)
+	inner := (*fn.Func.Stmts[0]).(*ast.FuncStmt)
+	if fn.Func.Generator || !inner.Func.Generator {
+		t.Errorf("Expected only the inner function to be a generator")
+	}
+
+	for _, input := range []string{"yield 1;", "break;", "fn f() { continue }", "for (x in xs) { fn f() { break } }", "for x xs {}"} {
+		ch := make(chan *token.Token)
+		p := New(lexer.New(input, ch), ch)
+		p.Parse()
+		if len(p.Errors) == 0 {
+			t.Errorf("%s: expected parse error", input)
+		}
+	}
+}
+
+func TestSpawnSelectAndMacros(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		{"spawn f(1, 2)", "spawn f(1, 2)"},
+		{"let m = macro(a, b) { quote(unquote(a) + b) };", "let m = macro(a, b) {quote((unquote(a)+b))};"},
+		{"select {\n\tc.recv() as v => v,\n\td.send(1) => 2\n\t_ => 3\n}", "select {c.recv() as v => v, d.send(1) => 2, _ => 3}"},
+	}
+
+	for _, tt := range tests {
+		program := setup(t, tt.input)
+		if output := program.String(); output != tt.expected {
+			t.Errorf("Expected %q, got %q", tt.expected, output)
+		}
+	}
+
+	for _, input := range []string{"spawn f;", "select { f() => 1 }", "select { c.send() => 1 }", "select { c.send(1) as v => v }", "macro([a]) {}"} {
+		ch := make(chan *token.Token)
+		p := New(lexer.New(input, ch), ch)
+		p.Parse()
+		if len(p.Errors) == 0 {
+			t.Errorf("%s: expected parse error", input)
+		}
+	}
+}
+
+func TestDocComments(t *testing.T) {
+	program := setup(t, "/// The answer.\nlet x = 42\n/// Adds.\n/// Twice.\nfn add(a, b) { a + b }\n/// Exported.\nexport fn f() {}\nlet y = 1\n")
+	expected := []string{"The answer.", "Adds.\nTwice.", "Exported.", ""}
+	docs := []string{
+		program.Stmts[0].(*ast.LetStmt).Doc,
+		program.Stmts[1].(*ast.FuncStmt).Doc,
+		program.Stmts[2].(*ast.ExportStmt).Stmt.(*ast.FuncStmt).Doc,
+		program.Stmts[3].(*ast.LetStmt).Doc,
+	}
+	for i, doc := range docs {
+		if doc != expected[i] {
+			t.Errorf("stmt %d: expected doc %q, got %q", i, expected[i], doc)
+		}
+	}
+}
+
+func TestTypeAnnotations(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		{"let x: int = 1;", "let x: int = 1;"},
+		{"let [a, b]: [string] = xs;", "let [a, b]: [string] = xs;"},
+		{"fn f(a: string, b: [int]) -> bool { true }", "fn f(a: string, b: [int]) -> bool {true}"},
+		{"let g = fn(h: {string: fn(int) -> int}, p: Point) { h };", "let g = fn(h: {string: fn(int) -> int}, p: Point) {h};"},
+	}
+
+	for _, tt := range tests {
+		program := setup(t, tt.input)
+		if output := program.String(); output != tt.expected {
+			t.Errorf("Expected %q, got %q", tt.expected, output)
+		}
+	}
+
+	for _, input := range []string{"let x: = 1;", "fn f(a: [int) {}", "fn f() -> {}", "let x: {int} = 1;"} {
+		ch := make(chan *token.Token)
+		p := New(lexer.New(input, ch), ch)
+		p.Parse()
+		if len(p.Errors) == 0 {
+			t.Errorf("%s: expected parse error", input)
+		}
+	}
+}
+
+func TestNullAndOptionalChaining(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		{"null", "null"},
+		{"a ?? b ?? c", "((a??b)??c)"},
+		{"a ?? b || c", "(a??(b||c))"},
+		{"x = a ?? b", "(x = (a??b))"},
+		{"a?.b.c", "a?.b.c"},
+		{"a?.[i]", "(a?.[i])"},
+		{"f?.(x)?.y", "f?.(x)?.y"},
+		{"a?.b ?? 1", "(a?.b??1)"},
+		{"let x: null = null;", "let x: null = null;"},
+	}
+
+	for _, tt := range tests {
+		program := setup(t, tt.input)
+		if output := program.String(); output != tt.expected {
+			t.Errorf("Expected %q, got %q", tt.expected, output)
+		}
+	}
+
+	for _, input := range []string{"a?.5", "a?.", "a?.b?.5"} {
+		ch := make(chan *token.Token)
+		p := New(lexer.New(input, ch), ch)
+		p.Parse()
+		if len(p.Errors) == 0 {
+			t.Errorf("%s: expected parse error", input)
+		}
+	}
+}
+
+func TestSliceExpr(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		{"s[1:4]", "(s[1:4])"},
+		{"xs[:-1]", "(xs[:(-1)])"},
+		{"xs[::2]", "(xs[::2])"},
+		{"xs[i + 1:]", "(xs[(i+1):])"},
+		{"xs[:]", "(xs[:])"},
+		{"xs?.[1:][0]", "((xs?.[1:])[0])"},
+	}
+
+	for _, tt := range tests {
+		program := setup(t, tt.input)
+		if output := program.String(); output != tt.expected {
+			t.Errorf("Expected %q, got %q", tt.expected, output)
+		}
+	}
+
+	for _, input := range []string{"xs[1:2:3:4]", "xs[1:2", "xs[1:2)"} {
+		ch := make(chan *token.Token)
+		p := New(lexer.New(input, ch), ch)
+		p.Parse()
+		if len(p.Errors) == 0 {
+			t.Errorf("%s: expected parse error", input)
+		}
+	}
+}
+
+func TestComprehensionExpr(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		{"[x * x for x in xs if x % 2 == 0]", "[(x*x) for x in xs if ((x%2)==0)]"},
+		{"[x for x in xs]", "[x for x in xs]"},
+		{"let m = {k: v for k, v in h};", "let m = {k: v for k, v in h};"},
+		{"[a for [a, _] in pairs]", "[a for [a, _] in pairs]"},
+		{"[1, 2]", "[1, 2]"},
+	}
+
+	for _, tt := range tests {
+		program := setup(t, tt.input)
+		if output := program.String(); output != tt.expected {
+			t.Errorf("Expected %q, got %q", tt.expected, output)
+		}
+	}
+
+	for _, input := range []string{"[x for x xs]", "[1, x for x in xs]", "[x for a, b, c in xs]", "let m = {k for k in h};", "[x for x in xs if]"} {
+		ch := make(chan *token.Token)
+		p := New(lexer.New(input, ch), ch)
+		p.Parse()
+		if len(p.Errors) == 0 {
+			t.Errorf("%s: expected parse error", input)
+		}
+	}
+}
+
+func TestRegexExpr(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		{`re"\d+"`, `re"\d+"`},
+		{`re"(?i)^get (\S+)$".match(line)`, `re"(?i)^get (\S+)$".match(line)`},
+		{`let re = 1;`, `let re = 1;`},
+	}
+
+	for _, tt := range tests {
+		program := setup(t, tt.input)
+		if output := program.String(); output != tt.expected {
+			t.Errorf("Expected %q, got %q", tt.expected, output)
+		}
+	}
+
+	for _, input := range []string{`re"(a"`, `re"a**"`, `re"\p{Nope}"`} {
+		ch := make(chan *token.Token)
+		p := New(lexer.New(input, ch), ch)
+		p.Parse()
+		if len(p.Errors) == 0 {
+			t.Errorf("%s: expected parse error", input)
+		}
+	}
+}
+
 func testIntLit(t *testing.T, expr ast.Expr, value int64) {
 	if intExpr, ok := expr.(*ast.IntLiteralExpr); !ok {
 		t.Fatalf("Not int expr, got %T", expr)
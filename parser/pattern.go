@@ -0,0 +1,128 @@
+package parser
+
+import (
+	"monkey/ast"
+	"monkey/token"
+)
+
+func (p *Parser) parsePattern() ast.Pattern {
+	switch p.cur.Type {
+	case token.Ident:
+		ident := &ast.IdentExpr{Token: p.cur, Value: p.cur.Literal}
+		if p.peek.Type == token.Dot || p.peek.Type == token.LParen {
+			return p.parseConstructorPattern(ident)
+		}
+		return ident
+	case token.Int:
+		return asPattern(p.parseIntLiteralExpr())
+	case token.Minus:
+		minus := p.cur
+		if !p.expect(token.Int, "pattern") {
+			return nil
+		}
+		lit, ok := p.parseIntLiteralExpr().(*ast.IntLiteralExpr)
+		if !ok {
+			return nil
+		}
+		return &ast.IntLiteralExpr{
+			Token: &token.Token{Type: token.Int, Literal: "-" + lit.Token.Literal, Row: minus.Row, Col: minus.Col},
+			Value: -lit.Value,
+		}
+	case token.DQuote:
+		return asPattern(p.parseStringExpr())
+	case token.True, token.False:
+		return asPattern(p.parseBoolExpr())
+	case token.Null:
+		return &ast.NullExpr{Token: p.cur}
+	case token.LBracket:
+		return p.parseArrayPattern()
+	case token.LBrace:
+		return p.parseHashPattern()
+	default:
+		p.errorf("Expected pattern, got `%s`", p.cur.Type.String())
+		return nil
+	}
+}
+
+func (p *Parser) parseArrayPattern() ast.Pattern {
+	pattern := &ast.ArrayPattern{Token: p.cur}
+	if !p.parseList(token.RBracket, "array pattern", func() bool {
+		if pattern.Rest != nil {
+			p.errorf("While parsing array pattern: Rest element must be last")
+			return false
+		}
+		if p.cur.Type == token.Ellipsis {
+			if !p.expect(token.Ident, "array pattern") {
+				return false
+			}
+			pattern.Rest = &ast.IdentExpr{Token: p.cur, Value: p.cur.Literal}
+			return true
+		}
+		elem := p.parsePattern()
+		pattern.Elems = append(pattern.Elems, elem)
+		return elem != nil
+	}) {
+		return nil
+	}
+	return pattern
+}
+
+func (p *Parser) parseConstructorPattern(ident *ast.IdentExpr) ast.Pattern {
+	pattern := &ast.ConstructorPattern{Token: p.cur, Type: ident}
+	for p.accept(token.Dot) {
+		member := &ast.MemberExpr{Token: p.cur, Object: pattern.Type}
+		if !p.expect(token.Ident, "constructor pattern") {
+			return nil
+		}
+		member.Member = &ast.IdentExpr{Token: p.cur, Value: p.cur.Literal}
+		pattern.Type = member
+	}
+	if p.accept(token.LParen) {
+		pattern.Args = []ast.Pattern{}
+		if !p.parseList(token.RParen, "constructor pattern", func() bool {
+			arg := p.parsePattern()
+			pattern.Args = append(pattern.Args, arg)
+			return arg != nil
+		}) {
+			return nil
+		}
+	}
+	return pattern
+}
+
+func (p *Parser) parseHashPattern() ast.Pattern {
+	pattern := &ast.HashPattern{Token: p.cur}
+	if !p.parseList(token.RBrace, "hash pattern", func() bool {
+		entry := &ast.HashPatternEntry{}
+		switch p.cur.Type {
+		case token.Ident:
+			entry.Key = p.cur.Literal
+			entry.Value = &ast.IdentExpr{Token: p.cur, Value: p.cur.Literal}
+			if !p.accept(token.Colon) {
+				pattern.Entries = append(pattern.Entries, entry)
+				return true
+			}
+		case token.DQuote:
+			key, ok := p.parseStringExpr().(*ast.StringExpr)
+			if !ok || !p.expect(token.Colon, "hash pattern") {
+				return false
+			}
+			entry.Key = key.Value
+		default:
+			p.errorf("While parsing hash pattern: Expected key, got `%s`", p.cur.Type.String())
+			return false
+		}
+		p.next()
+		entry.Value = p.parsePattern()
+		pattern.Entries = append(pattern.Entries, entry)
+		return entry.Value != nil
+	}) {
+		return nil
+	}
+	return pattern
+}
+
+func asPattern(expr ast.Expr) ast.Pattern {
+	pattern, _ := expr.(ast.Pattern)
+	return pattern
+}
@@ -3,41 +3,246 @@ package parser
 import (
 	"monkey/ast"
 	"monkey/token"
+	"path"
+	"strings"
 )
 
+func (p *Parser) parseTopLevelStmt() ast.Stmt {
+	switch p.cur.Type {
+	case token.Import:
+		return p.parseImportStmt()
+	case token.Export:
+		return p.parseExportStmt()
+	default:
+		return p.parseStmt()
+	}
+}
+
 func (p *Parser) parseStmt() ast.Stmt {
 	switch p.cur.Type {
-	case token.Let:
+	case token.Import, token.Export:
+		p.errorf("%s is only allowed at the top level", p.cur.Literal)
+		return nil
+	case token.Let, token.Const:
 		return p.parseLetStmt()
 	case token.Return:
 		return p.parseReturnStmt()
+	case token.Throw:
+		return p.parseThrowStmt()
+	case token.Defer:
+		return p.parseDeferStmt()
+	case token.Struct:
+		return p.parseStructStmt()
+	case token.Enum:
+		return p.parseEnumStmt()
+	case token.Yield:
+		return p.parseYieldStmt()
+	case token.For:
+		return p.parseForStmt()
+	case token.Break, token.Continue:
+		return p.parseBranchStmt()
+	case token.Function:
+		if p.peek.Type == token.Ident {
+			return p.parseFuncStmt()
+		}
+		return p.parseExprStmt()
 	case token.LBrace:
 		return p.parseBlockStmt()
+	case token.Semicolon:
+		return nil
 	default:
 		return p.parseExprStmt()
 	}
 }
 
 func (p *Parser) parseLetStmt() *ast.LetStmt {
-	stmt := &ast.LetStmt{Token: p.cur}
+	stmt := &ast.LetStmt{Token: p.cur, Doc: p.cur.Doc}
 
-	if !p.expect(token.Ident, "let stmt") {
+	p.next()
+	if stmt.Name = p.parseTypedPattern(); stmt.Name == nil {
 		return nil
 	}
-	stmt.Name = &ast.IdentExpr{Token: p.cur, Value: p.cur.Literal}
 
 	if !p.expect(token.Assign, "let stmt") {
 		return nil
 	}
 	p.next()
 	stmt.Value = p.parseExpr(precLowest)
-	if !p.expect(token.Semicolon, "let stmt") {
+	if p.peek.Type != token.RBrace && !p.expect(token.Semicolon, "let stmt") {
+		return nil
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseFuncStmt() *ast.FuncStmt {
+	stmt := &ast.FuncStmt{Token: p.cur, Doc: p.cur.Doc}
+	p.next()
+	stmt.Name = &ast.IdentExpr{Token: p.cur, Value: p.cur.Literal}
+	funcExpr, ok := p.parseFuncExpr().(*ast.FuncExpr)
+	if !ok {
+		return nil
+	}
+	funcExpr.Token = stmt.Token
+	stmt.Func = funcExpr
+	return stmt
+}
+
+func (p *Parser) parseImportStmt() *ast.ImportStmt {
+	stmt := &ast.ImportStmt{Token: p.cur}
+	if !p.expect(token.DQuote, "import stmt") {
+		return nil
+	}
+	if stmt.Path, _ = p.parseStringExpr().(*ast.StringExpr); stmt.Path == nil {
+		return nil
+	}
+	if p.accept(token.As) {
+		if !p.expect(token.Ident, "import stmt") {
+			return nil
+		}
+		stmt.Alias = &ast.IdentExpr{Token: p.cur, Value: p.cur.Literal}
+	} else {
+		name := path.Base(stmt.Path.Value)
+		name = strings.TrimSuffix(name, path.Ext(name))
+		stmt.Alias = &ast.IdentExpr{Token: stmt.Path.Token, Value: name}
+	}
+	if p.peek.Type != token.RBrace && !p.expect(token.Semicolon, "import stmt") {
 		return nil
 	}
+	return stmt
+}
+
+func (p *Parser) parseExportStmt() *ast.ExportStmt {
+	stmt := &ast.ExportStmt{Token: p.cur}
+	if p.peek.Doc == "" {
+		p.peek.Doc = p.cur.Doc
+	}
+	p.next()
+	switch p.cur.Type {
+	case token.Let, token.Const, token.Function, token.Struct, token.Enum:
+		stmt.Stmt = p.parseStmt()
+	}
+	switch stmt.Stmt.(type) {
+	case *ast.LetStmt, *ast.FuncStmt, *ast.StructStmt, *ast.EnumStmt:
+		return stmt
+	default:
+		p.errorf("Only let, const, fn, struct and enum declarations can be exported")
+		return nil
+	}
+}
 
+func (p *Parser) parseStructStmt() *ast.StructStmt {
+	stmt := &ast.StructStmt{Token: p.cur}
+	if !p.expect(token.Ident, "struct stmt") {
+		return nil
+	}
+	stmt.Name = &ast.IdentExpr{Token: p.cur, Value: p.cur.Literal}
+	if !p.expect(token.LBrace, "struct stmt") {
+		return nil
+	}
+	seen := make(map[string]bool)
+	stmt.Fields = []*ast.IdentExpr{}
+	methods, ok := p.parseTypeBody("struct stmt", func() bool {
+		field := p.parseFieldName("struct stmt", stmt.Name.Value, seen)
+		stmt.Fields = append(stmt.Fields, field)
+		return field != nil
+	})
+	if !ok {
+		return nil
+	}
+	stmt.Methods = methods
 	return stmt
 }
 
+func (p *Parser) parseEnumStmt() *ast.EnumStmt {
+	stmt := &ast.EnumStmt{Token: p.cur}
+	if !p.expect(token.Ident, "enum stmt") {
+		return nil
+	}
+	stmt.Name = &ast.IdentExpr{Token: p.cur, Value: p.cur.Literal}
+	if !p.expect(token.LBrace, "enum stmt") {
+		return nil
+	}
+	seen := make(map[string]bool)
+	methods, ok := p.parseTypeBody("enum stmt", func() bool {
+		if p.cur.Type != token.Ident {
+			p.errorf("While parsing enum stmt: Expected variant name, got `%s`", p.cur.Type.String())
+			return false
+		}
+		if seen[p.cur.Literal] {
+			p.errorf("Duplicate variant %s in enum %s", p.cur.Literal, stmt.Name)
+			return false
+		}
+		seen[p.cur.Literal] = true
+		variant := &ast.EnumVariant{Name: &ast.IdentExpr{Token: p.cur, Value: p.cur.Literal}}
+		stmt.Variants = append(stmt.Variants, variant)
+		if p.accept(token.LParen) {
+			variant.Fields = p.parseFieldList(token.RParen, "enum variant", stmt.Name.Value+"."+variant.Name.Value)
+			return variant.Fields != nil
+		}
+		return true
+	})
+	if !ok {
+		return nil
+	}
+	stmt.Methods = methods
+	return stmt
+}
+
+// parseTypeBody parses the members and methods of a struct or enum body,
+// separated by commas or newlines.
+func (p *Parser) parseTypeBody(caller string, parseMember func() bool) ([]*ast.FuncStmt, bool) {
+	var methods []*ast.FuncStmt
+	for !p.accept(token.RBrace) {
+		p.next()
+		if p.cur.Type == token.Function {
+			if p.peek.Type != token.Ident {
+				p.errorf("While parsing %s: Expected method name, got `%s`", caller, p.peek.Type.String())
+				return nil, false
+			}
+			method := p.parseFuncStmt()
+			if method == nil {
+				return nil, false
+			}
+			methods = append(methods, method)
+		} else if !parseMember() {
+			return nil, false
+		}
+		if p.peek.Type != token.RBrace && !p.accept(token.Semicolon) && !p.expect(token.Comma, caller) {
+			return nil, false
+		}
+	}
+	return methods, true
+}
+
+// parseFieldList parses the comma-separated field names of an enum variant,
+// returning nil on error.
+func (p *Parser) parseFieldList(end token.TokenType, caller, typeName string) []*ast.IdentExpr {
+	fields := []*ast.IdentExpr{}
+	seen := make(map[string]bool)
+	if !p.parseList(end, caller, func() bool {
+		field := p.parseFieldName(caller, typeName, seen)
+		fields = append(fields, field)
+		return field != nil
+	}) {
+		return nil
+	}
+	return fields
+}
+
+func (p *Parser) parseFieldName(caller, typeName string, seen map[string]bool) *ast.IdentExpr {
+	if p.cur.Type != token.Ident {
+		p.errorf("While parsing %s: Expected field name, got `%s`", caller, p.cur.Type.String())
+		return nil
+	}
+	if seen[p.cur.Literal] {
+		p.errorf("Duplicate field %s in %s", p.cur.Literal, typeName)
+		return nil
+	}
+	seen[p.cur.Literal] = true
+	return &ast.IdentExpr{Token: p.cur, Value: p.cur.Literal}
+}
+
 func (p *Parser) parseReturnStmt() *ast.ReturnStmt {
 	stmt := &ast.ReturnStmt{Token: p.cur}
 
@@ -47,13 +252,91 @@ func (p *Parser) parseReturnStmt() *ast.ReturnStmt {
 
 	p.next()
 	stmt.Value = p.parseExpr(precLowest)
-	if !p.expect(token.Semicolon, "return stmt") {
+	if p.peek.Type != token.RBrace && !p.expect(token.Semicolon, "return stmt") {
 		return nil
 	}
 
 	return stmt
 }
 
+func (p *Parser) parseThrowStmt() *ast.ThrowStmt {
+	stmt := &ast.ThrowStmt{Token: p.cur}
+	p.next()
+	if stmt.Value = p.parseExpr(precLowest); stmt.Value == nil {
+		p.errorf("While parsing throw stmt: Expected a value")
+		return nil
+	}
+	if p.peek.Type != token.RBrace && !p.expect(token.Semicolon, "throw stmt") {
+		return nil
+	}
+	return stmt
+}
+
+func (p *Parser) parseDeferStmt() *ast.DeferStmt {
+	stmt := &ast.DeferStmt{Token: p.cur}
+	p.next()
+	call, ok := p.parseExpr(precLowest).(*ast.FuncCallExpr)
+	if !ok {
+		p.errorf("While parsing defer stmt: Expected a function call")
+		return nil
+	}
+	stmt.Call = call
+	if p.peek.Type != token.RBrace && !p.expect(token.Semicolon, "defer stmt") {
+		return nil
+	}
+	return stmt
+}
+
+func (p *Parser) parseYieldStmt() *ast.YieldStmt {
+	stmt := &ast.YieldStmt{Token: p.cur}
+	if !p.inFunc {
+		p.errorf("yield outside of a function")
+		return nil
+	}
+	p.generator = true
+	if p.accept(token.Semicolon) || p.peek.Type == token.RBrace {
+		return stmt
+	}
+	p.next()
+	stmt.Value = p.parseExpr(precLowest)
+	if p.peek.Type != token.RBrace && !p.expect(token.Semicolon, "yield stmt") {
+		return nil
+	}
+	return stmt
+}
+
+func (p *Parser) parseForStmt() *ast.ForStmt {
+	stmt := &ast.ForStmt{Token: p.cur}
+	parens := p.accept(token.LParen)
+	p.next()
+	if stmt.Var = p.parsePattern(); stmt.Var == nil || !p.expect(token.In, "for stmt") {
+		return nil
+	}
+	p.next()
+	p.noStructLit = !parens
+	stmt.Iterable = p.parseExpr(precLowest)
+	p.noStructLit = false
+	if parens && !p.expect(token.RParen, "for stmt") || !p.expect(token.LBrace, "for stmt") {
+		return nil
+	}
+	p.loops++
+	stmt.Body = p.parseBlockStmt()
+	p.loops--
+	return stmt
+}
+
+func (p *Parser) parseBranchStmt() *ast.BranchStmt {
+	stmt := &ast.BranchStmt{Token: p.cur}
+	if p.loops == 0 {
+		p.errorf("%s outside of a loop", p.cur.Literal)
+		return nil
+	}
+	if p.peek.Type != token.RBrace && !p.expect(token.Semicolon, p.cur.Literal+" stmt") {
+		return nil
+	}
+	return stmt
+}
+
 func (p *Parser) parseExprStmt() *ast.ExprStmt {
 	stmt := &ast.ExprStmt{Token: p.cur}
 	stmt.Expr = p.parseExpr(precLowest)
@@ -65,7 +348,11 @@ func (p *Parser) parseBlockStmt() *ast.BlockStmt {
 	for p.next(); p.cur.Type != token.RBrace; p.next() {
 		stmt := p.parseStmt()
 		if stmt == nil {
-			return nil
+			continue
+		}
+		// An explicit `;`, unlike one inserted at a newline, discards the block's value.
+		if exprStmt, ok := stmt.(*ast.ExprStmt); ok && p.peek.Type == token.Semicolon && p.peek.Literal == ";" {
+			exprStmt.Discard = true
 		}
 		block.Stmts = append(block.Stmts, &stmt)
 	}
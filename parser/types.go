@@ -0,0 +1,64 @@
+package parser
+
+import (
+	"monkey/ast"
+	"monkey/token"
+)
+
+// parseTypedPattern parses a pattern with an optional type annotation.
+func (p *Parser) parseTypedPattern() ast.Pattern {
+	pattern := p.parsePattern()
+	if pattern == nil || !p.accept(token.Colon) {
+		return pattern
+	}
+	typed := &ast.TypedPattern{Token: p.cur, Pattern: pattern}
+	p.next()
+	if typed.Type = p.parseType(); typed.Type == nil {
+		return nil
+	}
+	return typed
+}
+
+func (p *Parser) parseType() ast.Type {
+	switch p.cur.Type {
+	case token.Ident, token.Null:
+		return &ast.NamedType{Token: p.cur, Name: p.cur.Literal}
+	case token.LBracket:
+		arrayType := &ast.ArrayType{Token: p.cur}
+		p.next()
+		if arrayType.Elem = p.parseType(); arrayType.Elem == nil || !p.expect(token.RBracket, "array type") {
+			return nil
+		}
+		return arrayType
+	case token.LBrace:
+		hashType := &ast.HashType{Token: p.cur}
+		p.next()
+		if hashType.Key = p.parseType(); hashType.Key == nil || !p.expect(token.Colon, "hash type") {
+			return nil
+		}
+		p.next()
+		if hashType.Value = p.parseType(); hashType.Value == nil || !p.expect(token.RBrace, "hash type") {
+			return nil
+		}
+		return hashType
+	case token.Function:
+		funcType := &ast.FuncType{Token: p.cur, Args: []ast.Type{}}
+		if !p.expect(token.LParen, "function type") || !p.parseList(token.RParen, "function type", func() bool {
+			arg := p.parseType()
+			funcType.Args = append(funcType.Args, arg)
+			return arg != nil
+		}) {
+			return nil
+		}
+		if p.accept(token.Arrow) {
+			p.next()
+			if funcType.Return = p.parseType(); funcType.Return == nil {
+				return nil
+			}
+		}
+		return funcType
+	default:
+		p.errorf("Expected type, got `%s`", p.cur.Type.String())
+		return nil
+	}
+}
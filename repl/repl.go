@@ -3,35 +3,70 @@ package repl
 import (
 	"bufio"
 	"fmt"
+	"monkey/ast"
 	"monkey/evaluator"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
 	"monkey/token"
 	"os"
+	"strings"
 )
 
 func Repl() {
 	scanner := bufio.NewScanner(os.Stdin)
 	env := object.NewEnv(nil)
+	macros := object.NewEnv(nil)
+	var docs string
 	for {
 		fmt.Print(">> ")
 		scanned := scanner.Scan()
 		if !scanned {
 			return
 		}
+		line := scanner.Text()
+		// Doc comments are kept for the declaration on the next line.
+		if strings.HasPrefix(strings.TrimSpace(line), "///") {
+			docs += line + "\n"
+			continue
+		}
+		// `:doc f` shows the doc comment of f.
+		name, showDoc := strings.CutPrefix(line, ":doc ")
+		if showDoc {
+			line = "doc(" + name + ")"
+		} else {
+			line = docs + line
+		}
+		docs = ""
 		ch := make(chan *token.Token)
-		l := lexer.New(scanner.Text(), ch)
+		l := lexer.New(line+"\n", ch)
 		p := parser.New(l, ch)
 		prog := p.Parse()
 		if p.Errors != nil {
 			for _, e := range p.Errors {
 				fmt.Println(e.String())
 			}
+		} else if expanded, err := expand(prog, macros); err != nil {
+			fmt.Println(err.Trace())
 		} else {
 			// fmt.Printf("%s\n", prog.String())
-			res := evaluator.Eval(prog, env)
-			fmt.Println(res)
+			res := evaluator.Eval(expanded, env)
+			if err, ok := res.(*object.ObjError); ok {
+				fmt.Println(err.Trace())
+			} else if doc, ok := res.(*object.ObjString); ok && showDoc {
+				fmt.Println(doc.Value)
+			} else if showDoc {
+				fmt.Printf("no documentation for %s\n", strings.TrimSpace(name))
+			} else if str, err := evaluator.Inspect(res); err != nil {
+				fmt.Println(err.Trace())
+			} else {
+				fmt.Println(str)
+			}
 		}
 	}
 }
+
+func expand(prog *ast.Program, macros object.Env) (*ast.Program, *object.ObjError) {
+	evaluator.DefineMacros(prog, macros)
+	return evaluator.ExpandMacros(prog, macros)
+}
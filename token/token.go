@@ -10,6 +10,7 @@ type Token struct {
 	Type     TokenType
 	Literal  string
 	Row, Col int
+	Doc      string // The `///` comment lines right before the token.
 }
 
 type tokenGroup map[string]TokenType
@@ -17,15 +18,31 @@ type tokenGroup map[string]TokenType
 const (
 	_ TokenType = iota
 	And
+	Arrow
+	As
 	Assign
 	Bang
+	Break
+	Catch
+	Coalesce
+	Colon
 	Comma
+	Const
+	Continue
 	DQuote
 	Decrement
+	Defer
+	Dot
 	EOF
+	Ellipsis
 	Else
+	Enum
 	Eq
+	Export
 	False
+	FatArrow
+	Finally
+	For
 	Function
 	Ge
 	Gt
@@ -33,27 +50,43 @@ const (
 	Ident
 	If
 	Illegal
+	Import
+	In
 	Increment
 	Int
 	LBrace
+	LBracket
 	LParen
 	Le
 	Let
 	Lt
+	Macro
+	Match
 	Minus
 	Modulo
 	Neq
+	Null
+	OptChain
 	Or
+	Pipe
 	Plus
 	RBrace
+	RBracket
 	RParen
+	Regex
 	Return
 	SQuote
+	Select
 	Semicolon
 	Slash
+	Spawn
 	Star
 	String
+	Struct
+	Throw
 	True
+	Try
+	Yield
 )
 
 var allTokens = func() map[TokenType]string {
@@ -67,42 +100,73 @@ var allTokens = func() map[TokenType]string {
 }()
 
 var SymToks = tokenGroup{
-	"!":  Bang,
-	"!=": Neq,
-	"#":  Hash,
-	"%":  Modulo,
-	"&&": And,
-	"'":  SQuote,
-	"(":  LParen,
-	")":  RParen,
-	"*":  Star,
-	"+":  Plus,
-	"++": Increment,
-	",":  Comma,
-	"-":  Minus,
-	"--": Decrement,
-	"/":  Slash,
-	";":  Semicolon,
-	"<":  Lt,
-	"<=": Le,
-	"=":  Assign,
-	"==": Eq,
-	">":  Gt,
-	">=": Ge,
-	"\"": DQuote,
-	"{":  LBrace,
-	"||": Or,
-	"}":  RBrace,
+	"!":   Bang,
+	"!=":  Neq,
+	"#":   Hash,
+	"%":   Modulo,
+	"&&":  And,
+	"'":   SQuote,
+	"(":   LParen,
+	")":   RParen,
+	"*":   Star,
+	"+":   Plus,
+	"++":  Increment,
+	",":   Comma,
+	"-":   Minus,
+	"--":  Decrement,
+	"->":  Arrow,
+	".":   Dot,
+	"...": Ellipsis,
+	"/":   Slash,
+	":":   Colon,
+	";":   Semicolon,
+	"<":   Lt,
+	"<=":  Le,
+	"=":   Assign,
+	"==":  Eq,
+	"=>":  FatArrow,
+	"?.":  OptChain,
+	"??":  Coalesce,
+	">":   Gt,
+	">=":  Ge,
+	"\"":  DQuote,
+	"[":   LBracket,
+	"]":   RBracket,
+	"{":   LBrace,
+	"|":   Pipe,
+	"||":  Or,
+	"}":   RBrace,
 }
 
 var Keywords = tokenGroup{
-	"else":   Else,
-	"false":  False,
-	"fn":     Function,
-	"if":     If,
-	"let":    Let,
-	"return": Return,
-	"true":   True,
+	"as":       As,
+	"break":    Break,
+	"catch":    Catch,
+	"const":    Const,
+	"continue": Continue,
+	"defer":    Defer,
+	"else":     Else,
+	"enum":     Enum,
+	"export":   Export,
+	"false":    False,
+	"finally":  Finally,
+	"fn":       Function,
+	"for":      For,
+	"if":       If,
+	"import":   Import,
+	"in":       In,
+	"let":      Let,
+	"macro":    Macro,
+	"match":    Match,
+	"null":     Null,
+	"return":   Return,
+	"select":   Select,
+	"spawn":    Spawn,
+	"struct":   Struct,
+	"throw":    Throw,
+	"true":     True,
+	"try":      Try,
+	"yield":    Yield,
 }
 
 var special = tokenGroup{
@@ -110,4 +174,5 @@ var special = tokenGroup{
 	"INT":     Int,
 	"IDENT":   Ident,
 	"ILLEGAL": Illegal,
+	"REGEX":   Regex,
 }